@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +19,7 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"github.com/olivierh59500/ym-player/pkg/archive"
 	"github.com/olivierh59500/ym-player/pkg/audio"
 	"github.com/olivierh59500/ym-player/pkg/stsound"
 )
@@ -42,23 +44,29 @@ type YMPlayerGUI struct {
 	repeatMode     RepeatMode
 
 	// UI Elements
-	titleLabel   *widget.Label
-	authorLabel  *widget.Label
-	commentLabel *widget.Label
-	typeLabel    *widget.Label
-	timeLabel    *widget.Label
-	progressBar  *widget.ProgressBar
-	volumeSlider *widget.Slider
-	playButton   *widget.Button
-	pauseButton  *widget.Button
-	stopButton   *widget.Button
-	prevButton   *widget.Button
-	nextButton   *widget.Button
-	loopCheck    *widget.Check
-	lowpassCheck *widget.Check
-	shuffleCheck *widget.Check
-	repeatButton *widget.Button
-	cpuLabel     *widget.Label
+	titleLabel    *widget.Label
+	authorLabel   *widget.Label
+	commentLabel  *widget.Label
+	typeLabel     *widget.Label
+	timeLabel     *widget.Label
+	progressBar   *widget.ProgressBar
+	volumeSlider  *widget.Slider
+	playButton    *widget.Button
+	pauseButton   *widget.Button
+	stopButton    *widget.Button
+	prevButton    *widget.Button
+	nextButton    *widget.Button
+	loopCheck     *widget.Check
+	lowpassCheck  *widget.Check
+	stereoSelect  *widget.Select
+	machineSelect *widget.Select
+	loopsSelect   *widget.Select
+	fadeSelect    *widget.Select
+	filterEntry   *widget.SelectEntry
+	voiceButtons  [3]*widget.Button
+	shuffleCheck  *widget.Check
+	repeatButton  *widget.Button
+	cpuLabel      *widget.Label
 
 	// Playlist UI
 	addButton      *widget.Button
@@ -70,6 +78,7 @@ type YMPlayerGUI struct {
 
 	// File info
 	currentFile string
+	currentData []byte // Unpacked YM data, kept for the WAV export
 	duration    uint32
 	position    uint32
 
@@ -79,6 +88,11 @@ type YMPlayerGUI struct {
 	bufferSize int
 	loop       bool
 	lowpass    bool
+	stereoMode stsound.StereoMode
+	voiceMuted [3]bool
+	machine    *stsound.Machine      // Forced profile, nil to follow the file header
+	filters    []stsound.FilterStage // Custom filter chain, nil for the default one
+	loopPolicy stsound.LoopPolicy    // Loops and fade-out, also used by the WAV export
 
 	// Update ticker
 	ticker *time.Ticker
@@ -179,6 +193,7 @@ func NewYMPlayerGUI() *YMPlayerGUI {
 		bufferSize:   2048,
 		loop:         false,
 		lowpass:      true,
+		stereoMode:   stsound.StereoABC,
 		done:         make(chan bool),
 		playlist:     NewPlaylist("Default"),
 		currentIndex: -1,
@@ -326,21 +341,95 @@ func (p *YMPlayerGUI) createMainContent() fyne.CanvasObject {
 		p.mutex.Lock()
 		p.lowpass = checked
 		if p.player != nil {
-			p.player.SetLowpassFilter(checked)
+			p.applyFilters(p.player)
 		}
 		p.mutex.Unlock()
 	})
 	p.lowpassCheck.SetChecked(true)
 
+	stereoModes := []stsound.StereoMode{stsound.StereoMono, stsound.StereoABC, stsound.StereoACB, stsound.StereoBAC}
+	stereoNames := make([]string, len(stereoModes))
+	for i, mode := range stereoModes {
+		stereoNames[i] = strings.ToUpper(mode.String())
+	}
+	p.stereoSelect = widget.NewSelect(stereoNames, func(selected string) {
+		p.mutex.Lock()
+		for i, name := range stereoNames {
+			if name == selected {
+				p.stereoMode = stereoModes[i]
+			}
+		}
+		if p.player != nil {
+			p.player.SetStereoMode(p.stereoMode)
+		}
+		p.mutex.Unlock()
+	})
+	p.stereoSelect.SetSelected(strings.ToUpper(p.stereoMode.String()))
+
+	// Machine profile: "File" keeps the clock and rate of the YM header
+	machineNames := []string{"File"}
+	for _, m := range stsound.MachineProfiles() {
+		machineNames = append(machineNames, m.Name)
+	}
+	p.machineSelect = widget.NewSelect(machineNames, func(selected string) {
+		p.selectMachine(selected)
+	})
+	p.machineSelect.SetSelected("File")
+
+	// Loops and fade-out: "Off" follows the Loop Track check
+	p.loopsSelect = widget.NewSelect([]string{"Off", "1", "2", "3", "4"}, func(selected string) {
+		loops, _ := strconv.Atoi(selected)
+		p.setLoopPolicy(loops, p.loopPolicy.Fade)
+	})
+	p.loopsSelect.SetSelected("Off")
+	p.fadeSelect = widget.NewSelect([]string{"0s", "4s", "8s", "16s"}, func(selected string) {
+		fade, _ := time.ParseDuration(selected)
+		p.setLoopPolicy(p.loopPolicy.Loops, fade)
+	})
+	p.fadeSelect.SetSelected("0s")
+
+	// Filter chain: empty keeps the default one, toggled by the low-pass check
+	p.filterEntry = widget.NewSelectEntry([]string{
+		"dc,3tap",
+		"dc,st",
+		"dc,lowpass:8000",
+		"dc,highpass:30,lowpass:12000",
+		"none",
+	})
+	p.filterEntry.SetPlaceHolder("Default")
+	p.filterEntry.OnChanged = p.setFilterChain
+
 	p.shuffleCheck = widget.NewCheck("Shuffle", func(checked bool) {
 		p.shuffle = checked
 	})
 
 	p.repeatButton = widget.NewButton("Repeat: Off", p.toggleRepeatMode)
 
+	// Voice toggles: a muted voice is shown dimmed
+	voicesContainer := container.NewHBox(widget.NewLabel("Voices:"))
+	for voice := range p.voiceButtons {
+		voice := voice
+		p.voiceButtons[voice] = widget.NewButton(string(rune('A'+voice)), func() {
+			p.toggleVoice(voice)
+		})
+		p.voiceButtons[voice].Importance = widget.HighImportance
+		voicesContainer.Add(p.voiceButtons[voice])
+	}
+	voicesContainer.Add(widget.NewSeparator())
+	voicesContainer.Add(widget.NewLabel("Filters:"))
+	voicesContainer.Add(container.NewGridWrap(fyne.NewSize(260, p.filterEntry.MinSize().Height), p.filterEntry))
+
 	optionsContainer := container.NewHBox(
 		p.loopCheck,
 		p.lowpassCheck,
+		widget.NewLabel("Stereo:"),
+		p.stereoSelect,
+		widget.NewLabel("Machine:"),
+		p.machineSelect,
+		widget.NewLabel("Loops:"),
+		p.loopsSelect,
+		widget.NewLabel("Fade:"),
+		p.fadeSelect,
 		widget.NewSeparator(),
 		p.shuffleCheck,
 		p.repeatButton,
@@ -368,6 +457,7 @@ func (p *YMPlayerGUI) createMainContent() fyne.CanvasObject {
 		widget.NewSeparator(),
 		volumeContainer,
 		optionsContainer,
+		voicesContainer,
 		layout.NewSpacer(),
 		tipCard,
 		statusBar,
@@ -578,13 +668,12 @@ func (p *YMPlayerGUI) addFolder() {
 			return
 		}
 
-		// Add all YM files
+		// Add all YM files, and every tune found in archives
 		added := 0
 		for _, file := range files {
-			if strings.HasSuffix(strings.ToLower(file.Name()), ".ym") ||
-				strings.HasSuffix(strings.ToLower(file.Name()), ".lzh") {
-				p.addFileToPlaylist(file.Path())
-				added++
+			switch strings.ToLower(filepath.Ext(file.Name())) {
+			case ".ym", ".lzh", ".lha", ".zip":
+				added += p.addFileToPlaylist(file.Path())
 			}
 		}
 
@@ -595,15 +684,52 @@ func (p *YMPlayerGUI) addFolder() {
 	}, p.window)
 }
 
-func (p *YMPlayerGUI) addFileToPlaylist(filePath string) {
+// addFileToPlaylist adds a YM file, or each tune of an archive, and
+// returns the number of playlist items created
+func (p *YMPlayerGUI) addFileToPlaylist(filePath string) int {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		log.Printf("Failed to load %s: %v", filePath, err)
+		return 0
+	}
+
+	// Un fichier .ym compressé est lui-même une archive LHA d'un seul membre
+	if stsound.IsYMFileName(filePath) || !archive.IsArchive(data) {
+		if p.addTuneToPlaylist(filePath, "", data) {
+			return 1
+		}
+		return 0
+	}
+
+	arc, err := archive.NewReader(data)
+	if err != nil {
+		log.Printf("Failed to open archive %s: %v", filePath, err)
+		return 0
+	}
+
+	added := 0
+	for _, name := range arc.Tunes() {
+		member, err := arc.ReadFile(name)
+		if err != nil {
+			log.Printf("Failed to load %s from %s: %v", name, filePath, err)
+			continue
+		}
+		if p.addTuneToPlaylist(filePath, name, member) {
+			added++
+		}
+	}
+	return added
+}
+
+func (p *YMPlayerGUI) addTuneToPlaylist(filePath, entry string, data []byte) bool {
 	// Create temporary player to get file info
 	tempPlayer := stsound.CreateWithRate(p.sampleRate)
 	defer tempPlayer.Destroy()
 
 	// Try to load file
-	if err := tempPlayer.Load(filePath); err != nil {
+	if err := tempPlayer.LoadMemory(data); err != nil {
 		log.Printf("Failed to load %s: %v", filePath, err)
-		return
+		return false
 	}
 
 	// Get file info
@@ -612,6 +738,7 @@ func (p *YMPlayerGUI) addFileToPlaylist(filePath string) {
 	// Create playlist item
 	item := &PlaylistItem{
 		Path:     filePath,
+		Entry:    entry,
 		Title:    info.SongName,
 		Author:   info.SongAuthor,
 		Duration: uint32(info.MusicTimeInMs),
@@ -621,7 +748,11 @@ func (p *YMPlayerGUI) addFileToPlaylist(filePath string) {
 
 	// Clean up empty titles/authors
 	if item.Title == "" || item.Title == "Unknown" {
-		item.Title = strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+		name := filePath
+		if entry != "" {
+			name = entry
+		}
+		item.Title = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
 	}
 	if item.Author == "" {
 		item.Author = "Unknown"
@@ -637,6 +768,7 @@ func (p *YMPlayerGUI) addFileToPlaylist(filePath string) {
 		p.playButton.Enable()
 		p.currentIndex = 0
 	}
+	return true
 }
 
 func (p *YMPlayerGUI) loadYMData(filename string, data []byte) {
@@ -659,7 +791,8 @@ func (p *YMPlayerGUI) loadYMData(filename string, data []byte) {
 
 	// Create new player
 	p.player = stsound.CreateWithRate(p.sampleRate)
-	p.buffer = make([]int16, p.bufferSize)
+	p.player.SetMachine(p.machine)
+	p.buffer = make([]int16, p.bufferSize*2)
 
 	// Load YM data
 	if err := p.player.LoadMemory(data); err != nil {
@@ -669,7 +802,8 @@ func (p *YMPlayerGUI) loadYMData(filename string, data []byte) {
 		return
 	}
 
-	// Update UI with song info
+	// Update UI with song info, duration including the loops and the fade
+	p.player.SetLoopPolicy(p.loopPolicy)
 	info := p.player.GetInfo()
 
 	p.titleLabel.SetText(info.SongName)
@@ -682,12 +816,17 @@ func (p *YMPlayerGUI) loadYMData(filename string, data []byte) {
 	p.typeLabel.SetText(info.SongType + " • " + info.SongPlayer)
 
 	p.currentFile = filename
+	p.currentData = data
 	p.duration = uint32(info.MusicTimeInMs)
 	p.position = 0
 
 	// Set options
 	p.player.SetLoopMode(p.loop || p.repeatMode == RepeatOne)
-	p.player.SetLowpassFilter(p.lowpass)
+	p.applyFilters(p.player)
+	p.player.SetStereoMode(p.stereoMode)
+	for voice, muted := range p.voiceMuted {
+		p.player.MuteVoice(voice, muted)
+	}
 
 	// Update progress
 	p.progressBar.SetValue(0)
@@ -718,7 +857,7 @@ func (p *YMPlayerGUI) play() {
 	}
 
 	// Open audio
-	if err := p.audioOutput.Open(p.sampleRate, 1, p.bufferSize); err != nil {
+	if err := p.audioOutput.Open(p.sampleRate, 2, p.bufferSize); err != nil {
 		dialog.ShowError(err, p.window)
 		p.audioOutput = nil
 		return
@@ -801,7 +940,7 @@ func (p *YMPlayerGUI) playbackLoop() {
 		}
 
 		// Generate audio
-		if !p.player.Compute(p.buffer, len(p.buffer)) {
+		if !p.player.ComputeStereo(p.buffer, p.bufferSize) {
 			if p.repeatMode == RepeatOne {
 				// Repeat current track
 				p.player.Restart()
@@ -844,7 +983,7 @@ func (p *YMPlayerGUI) playFromIndex(index int) {
 	// Load new file
 	item, _ := p.playlist.Get(index)
 	if item != nil {
-		data, err := os.ReadFile(item.Path)
+		data, err := item.ReadData()
 		if err != nil {
 			dialog.ShowError(err, p.window)
 			return
@@ -1011,6 +1150,92 @@ func (p *YMPlayerGUI) toggleRepeatMode() {
 	}
 }
 
+// setFilterChain applies the chain typed or picked in the filter entry
+func (p *YMPlayerGUI) setFilterChain(spec string) {
+	var stages []stsound.FilterStage
+	if strings.TrimSpace(spec) != "" {
+		var err error
+		if stages, err = stsound.ParseFilterChain(spec); err != nil {
+			// Saisie incomplète : on garde la chaîne précédente
+			return
+		}
+	}
+
+	p.mutex.Lock()
+	p.filters = stages
+	if p.player != nil {
+		p.applyFilters(p.player)
+	}
+	p.mutex.Unlock()
+
+	// La case low-pass ne s'applique qu'à la chaîne par défaut
+	if stages != nil {
+		p.lowpassCheck.Disable()
+	} else {
+		p.lowpassCheck.Enable()
+	}
+}
+
+// applyFilters sets the custom filter chain, or the default one
+func (p *YMPlayerGUI) applyFilters(player *stsound.StSound) {
+	if p.filters != nil {
+		player.SetFilterChain(p.filters)
+	} else {
+		player.SetLowpassFilter(p.lowpass)
+	}
+}
+
+// selectMachine forces the chosen machine profile on the current and next songs
+func (p *YMPlayerGUI) selectMachine(name string) {
+	p.mutex.Lock()
+	p.machine = nil
+	if profile, err := stsound.FindMachine(name); err == nil {
+		p.machine = &profile
+	}
+	machine := p.machine
+	if p.player != nil {
+		p.player.SetMachine(machine)
+		p.duration = uint32(p.player.GetInfo().MusicTimeInMs)
+	}
+	p.mutex.Unlock()
+
+	// Le profil impose aussi la stéréo et le filtre, les cases suivent
+	if machine != nil {
+		p.stereoSelect.SetSelected(strings.ToUpper(machine.Stereo.String()))
+		p.lowpassCheck.SetChecked(machine.LowPass)
+	}
+}
+
+// setLoopPolicy plays the current and next songs loops times, then fades
+// them out
+func (p *YMPlayerGUI) setLoopPolicy(loops int, fade time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.loopPolicy = stsound.LoopPolicy{Loops: loops, Fade: fade}
+	if p.player != nil {
+		p.player.SetLoopPolicy(p.loopPolicy)
+		p.duration = uint32(p.player.GetInfo().MusicTimeInMs)
+	}
+}
+
+// toggleVoice mutes or unmutes one of the three YM voices
+func (p *YMPlayerGUI) toggleVoice(voice int) {
+	p.mutex.Lock()
+	p.voiceMuted[voice] = !p.voiceMuted[voice]
+	muted := p.voiceMuted[voice]
+	if p.player != nil {
+		p.player.MuteVoice(voice, muted)
+	}
+	p.mutex.Unlock()
+
+	if muted {
+		p.voiceButtons[voice].Importance = widget.LowImportance
+	} else {
+		p.voiceButtons[voice].Importance = widget.HighImportance
+	}
+	p.voiceButtons[voice].Refresh()
+}
+
 func (p *YMPlayerGUI) updatePlaylistLabel() {
 	total := p.playlist.TotalDuration()
 	totalStr := formatTime(total)
@@ -1059,35 +1284,37 @@ func (p *YMPlayerGUI) exportToWAV(filename string, progress dialog.Dialog) error
 	// Create temporary player for export
 	exportPlayer := stsound.CreateWithRate(p.sampleRate)
 	defer exportPlayer.Destroy()
+	exportPlayer.SetMachine(p.machine)
 
 	// Reload the file
-	data, err := os.ReadFile(p.currentFile)
-	if err != nil {
+	if err := exportPlayer.LoadMemory(p.currentData); err != nil {
 		return err
 	}
-
-	if err := exportPlayer.LoadMemory(data); err != nil {
-		return err
+	p.applyFilters(exportPlayer)
+	exportPlayer.SetStereoMode(p.stereoMode)
+	exportPlayer.SetLoopPolicy(p.loopPolicy)
+	for voice, muted := range p.voiceMuted {
+		exportPlayer.MuteVoice(voice, muted)
 	}
 
 	// Create WAV output
 	wavOut := &WAVOutput{filename: filename}
-	if err := wavOut.Open(p.sampleRate, 1, p.bufferSize); err != nil {
+	if err := wavOut.Open(p.sampleRate, 2, p.bufferSize); err != nil {
 		return err
 	}
 	defer wavOut.Close()
 
 	// Export
-	buffer := make([]int16, p.bufferSize)
+	buffer := make([]int16, p.bufferSize*2)
 	exportPlayer.Play()
 
 	info := exportPlayer.GetInfo()
 	totalSamples := int(info.MusicTimeInMs) * p.sampleRate / 1000
 	processed := 0
 
-	for exportPlayer.Compute(buffer, len(buffer)) {
+	for exportPlayer.ComputeStereo(buffer, p.bufferSize) {
 		wavOut.Write(buffer)
-		processed += len(buffer)
+		processed += p.bufferSize
 
 		// Update progress
 		if totalSamples > 0 {
@@ -1112,7 +1339,7 @@ func (p *YMPlayerGUI) showAbout() {
 		widget.NewLabel("Based on ST-Sound by Arnaud Carré (Leonard/Oxygene)"),
 		widget.NewLabel("Go port with Fyne GUI"),
 		widget.NewLabel(""),
-		widget.NewLabel("Supports: YM2!, YM3!, YM3b, YM5!, YM6!"),
+		widget.NewLabel("Supports: YM2! to YM6!, MIX1, YMT1/YMT2"),
 		widget.NewLabel("With LZH compression support"),
 		widget.NewLabel(""),
 		container.NewHBox(
@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/olivierh59500/ym-player/pkg/archive"
 )
 
 // PlaylistItem represents a single item in the playlist
 type PlaylistItem struct {
 	Path     string `json:"path"`
+	Entry    string `json:"entry,omitempty"` // Member name when Path is an archive
 	Title    string `json:"title"`
 	Author   string `json:"author"`
 	Duration uint32 `json:"duration"` // in milliseconds
@@ -17,6 +20,19 @@ type PlaylistItem struct {
 	Type     string `json:"type,omitempty"`
 }
 
+// ReadData returns the YM data of the item, unpacked from its archive if needed
+func (item *PlaylistItem) ReadData() ([]byte, error) {
+	if item.Entry == "" {
+		return os.ReadFile(item.Path)
+	}
+
+	arc, err := archive.Open(item.Path)
+	if err != nil {
+		return nil, err
+	}
+	return arc.ReadFile(item.Entry)
+}
+
 // Playlist manages a collection of YM files
 type Playlist struct {
 	Name  string          `json:"name"`
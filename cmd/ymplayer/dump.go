@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/olivierh59500/ym-player/pkg/stsound"
+)
+
+// runDump implements "ymplayer dump": the register frames of a tune are
+// written as text, CSV or JSON Lines, with their decoded fields
+func runDump(args []string) {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	formatName := fs.String("format", "text", "Dump format: text, csv or jsonl")
+	outFile := fs.String("o", "", "Output file (default: standard output)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s dump [options] <ym-file>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Write the register frames of a YM2 to YM6 tune, \"import\" reads them back.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	format, err := stsound.ParseDumpFormat(*formatName)
+	if err != nil {
+		log.Fatalf("-format: %v", err)
+	}
+
+	tunes, err := collectTunes(fs.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(tunes) != 1 {
+		log.Fatalf("%s holds %d tunes, dump takes a single one", fs.Arg(0), len(tunes))
+	}
+
+	player := stsound.Create()
+	defer player.Destroy()
+	if err := player.LoadMemory(tunes[0].data); err != nil {
+		log.Fatalf("%s: %v", tunes[0].name, err)
+	}
+	song, err := player.Song()
+	if err != nil {
+		log.Fatalf("%s: %v", tunes[0].name, err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := stsound.DumpSong(w, song, format); err != nil {
+		log.Fatalf("dump failed: %v", err)
+	}
+}
+
+// runImport implements "ymplayer import": a dump, possibly edited, becomes
+// a playable YM5 or YM6 file
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	outFile := fs.String("o", "", "Output YM file (default: the dump file with a .ym extension)")
+	interleave := fs.Bool("interleave", false, "Store the registers interleaved (packs better)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s import [options] <dump-file>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Turn a text, CSV or JSON Lines register dump back into a YM file.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	in := fs.Arg(0)
+	out := *outFile
+	if out == "" {
+		out = strings.TrimSuffix(in, filepath.Ext(in)) + ".ym"
+		if out == in {
+			log.Fatalf("%s: give the output file with -o", in)
+		}
+	}
+
+	f, err := os.Open(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	song, err := stsound.ReadDump(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", in, err)
+	}
+	song.Interleaved = *interleave
+
+	data, err := stsound.EncodeYM(song)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %s (%d frames)\n", out, len(song.Frames))
+}
@@ -12,6 +12,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/olivierh59500/ym-player/pkg/archive"
 	"github.com/olivierh59500/ym-player/pkg/audio"
 	"github.com/olivierh59500/ym-player/pkg/stsound"
 )
@@ -26,12 +27,75 @@ var (
 	info       = flag.Bool("info", false, "Show file info only")
 	output     = flag.String("output", "oto", "Output backend (oto, wav, null)")
 	wavFile    = flag.String("wav", "", "Output WAV file (when using wav output)")
+	stereo     = flag.String("stereo", "abc", "Stereo panning: mono, abc, acb, bac or custom A,B,C positions (0=left, 1=right)")
+	mute       = flag.String("mute", "", "Voices to mute, e.g. a,c")
+	solo       = flag.String("solo", "", "Voices to play alone, e.g. b")
+	multitrack = flag.Bool("multitrack", false, "Export each voice to song_A.wav, song_B.wav and song_C.wav")
+	withMix    = flag.Bool("multitrack-mix", false, "Also write song_mix.wav with -multitrack")
+	coreName   = flag.String("core", "fast", "Emulation core: fast, or accurate (slower, band-limited)")
+	chipName   = flag.String("chip", "ym", "Sound chip model: ym (YM2149, Atari ST) or ay (AY-3-8910, Amstrad CPC/Spectrum)")
+	mixName    = flag.String("mix", "linear", "Voice mix: linear, or measured (table given with -mixtable)")
+	mixFile    = flag.String("mixtable", "", "Mix table measured on a real chip for -mix measured: 4096 levels, e.g. a C array")
+	filterArg  = flag.String("filter", "", "Output filter chain, e.g. dc,lowpass:8000:0.7,st or none (default: dc,3tap, dc with -lowpass=false)")
+	machineArg = flag.String("machine", "", "Force a machine profile over the file header: st, cpc, spectrum or msx")
+	loops      = flag.Int("loops", 0, "Play the song N times, then stop or fade out (0: once, or forever with -loop)")
+	fade       = flag.Duration("fade", 0, "Fade-out after the last loop of -loops, e.g. 8s")
+	fadeCurve  = flag.String("fade-curve", "linear", "Fade-out curve: linear, cosine or exp")
+	autoStop   = flag.Bool("autostop", false, "Stop at the end of the tune when the song runs on with silence or repeats itself")
 )
 
+var (
+	// Voice pan positions selected with -stereo
+	pans [3]float64
+
+	// Voices given to -mute and -solo
+	mutedVoices  []int
+	soloedVoices []int
+
+	// Core selected with -core
+	core stsound.YmCore
+
+	// Chip model selected with -chip
+	chipModel stsound.ChipModel
+
+	// Mix model selected with -mix, and its table read from -mixtable
+	mixModel stsound.MixModel
+	mixTable *stsound.MixTable
+
+	// Filter chain selected with -filter, nil for the default one
+	filterStages []stsound.FilterStage
+
+	// Machine profile forced with -machine, nil to use the file header
+	machine *stsound.Machine
+
+	// Loops and fade-out selected with -loops, -fade and -fade-curve
+	loopPolicy stsound.LoopPolicy
+)
+
+// tune is a song to play: a YM file or a member of an archive
+type tune struct {
+	name string
+	data []byte
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dump":
+			runDump(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <ym-file>\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "YM Player - Play Atari ST YM music files\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <ym-file|archive>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s dump [-format text|csv|jsonl] [-o file] <ym-file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s import [-o file.ym] <dump-file>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "YM Player - Play Atari ST YM music files\n")
+		fmt.Fprintf(os.Stderr, "LHA/LZH and ZIP archives are expanded to every YM tune they contain.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 	}
@@ -43,58 +107,120 @@ func main() {
 		os.Exit(1)
 	}
 
-	ymFile := flag.Arg(0)
+	_, stereoPans, err := stsound.ParsePanning(*stereo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pans = stereoPans
 
-	// Check if file exists
-	if _, err := os.Stat(ymFile); os.IsNotExist(err) {
-		log.Fatalf("File not found: %s", ymFile)
+	if mutedVoices, err = stsound.ParseVoices(*mute); err != nil {
+		log.Fatalf("-mute: %v", err)
+	}
+	if soloedVoices, err = stsound.ParseVoices(*solo); err != nil {
+		log.Fatalf("-solo: %v", err)
 	}
 
-	// Try to get file info first
-	data, err := os.ReadFile(ymFile)
-	if err != nil {
-		log.Fatalf("Failed to read file: %v", err)
+	switch *coreName {
+	case "fast":
+		core = stsound.CoreFast
+	case "accurate":
+		core = stsound.CoreAccurate
+	default:
+		log.Fatalf("Unknown core: %s", *coreName)
 	}
 
-	format, compressed, err := stsound.GetYMInfo(data)
-	if err != nil {
-		log.Fatalf("Failed to identify file format: %v", err)
+	if chipModel, err = stsound.ParseChipModel(*chipName); err != nil {
+		log.Fatal(err)
+	}
+	if mixModel, err = stsound.ParseMixModel(*mixName); err != nil {
+		log.Fatal(err)
+	}
+	if *mixFile != "" {
+		f, err := os.Open(*mixFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mixTable, err = stsound.ParseMixTable(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("-mixtable: %v", err)
+		}
+	}
+	if mixModel == stsound.MixMeasured && mixTable == nil {
+		log.Fatalf("-mix measured needs -mixtable")
 	}
 
-	fmt.Printf("File format: %s", format)
-	if compressed {
-		fmt.Printf(" (compressed)")
+	if *filterArg != "" {
+		if filterStages, err = stsound.ParseFilterChain(*filterArg); err != nil {
+			log.Fatalf("-filter: %v", err)
+		}
 	}
-	fmt.Printf("\n")
 
-	// Create YM player
-	player := stsound.CreateWithRate(*sampleRate)
-	defer player.Destroy()
+	if *machineArg != "" {
+		profile, err := stsound.FindMachine(*machineArg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		machine = &profile
 
-	// Load YM file
-	fmt.Printf("Loading %s...\n", filepath.Base(ymFile))
-	if err := player.Load(ymFile); err != nil {
-		log.Fatalf("Failed to load YM file: %v", err)
+		// Les options données explicitement passent avant le profil
+		explicit := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if !explicit["stereo"] {
+			pans = profile.Stereo.Pans()
+		}
+		if !explicit["chip"] {
+			chipModel = profile.Chip
+		}
+		if !explicit["lowpass"] {
+			*lowpass = profile.LowPass
+		}
 	}
 
-	// Get and display info
-	musicInfo := player.GetInfo()
-	fmt.Printf("\n")
-	fmt.Printf("Title:    %s\n", musicInfo.SongName)
-	fmt.Printf("Author:   %s\n", musicInfo.SongAuthor)
-	fmt.Printf("Comment:  %s\n", musicInfo.SongComment)
-	fmt.Printf("Type:     %s\n", musicInfo.SongType)
-	fmt.Printf("Duration: %s\n", formatDuration(uint32(musicInfo.MusicTimeInMs)))
-	fmt.Printf("\n")
+	if *loops < 0 {
+		log.Fatalf("-loops: %d is not a positive number", *loops)
+	}
+	if *fade != 0 && *loops == 0 {
+		log.Fatalf("-fade needs -loops")
+	}
+	if *autoStop && (*loop || *loops > 0) {
+		log.Fatalf("-autostop cannot be combined with -loop or -loops")
+	}
+	loopPolicy = stsound.LoopPolicy{Loops: *loops, Fade: *fade}
+	if loopPolicy.Curve, err = stsound.ParseFadeCurve(*fadeCurve); err != nil {
+		log.Fatalf("-fade-curve: %v", err)
+	}
+
+	tunes, err := collectTunes(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(tunes) == 0 {
+		log.Fatalf("No YM tune found")
+	}
 
 	if *info {
 		// Info only mode
+		for _, t := range tunes {
+			player, musicInfo, err := loadTune(t)
+			if err != nil {
+				log.Printf("Failed to load YM file: %v", err)
+				continue
+			}
+			printInfo(musicInfo)
+			player.Destroy()
+		}
 		return
 	}
 
-	// Set options
-	player.SetLoopMode(*loop)
-	player.SetLowpassFilter(*lowpass)
+	if *multitrack {
+		for _, t := range tunes {
+			if err := exportMultitrack(t); err != nil {
+				log.Printf("Multitrack export failed: %v", err)
+			}
+		}
+		return
+	}
 
 	// Create audio output
 	var audioOut audio.Output
@@ -109,7 +235,8 @@ func main() {
 		}
 	case "wav":
 		if *wavFile == "" {
-			*wavFile = strings.TrimSuffix(ymFile, filepath.Ext(ymFile)) + ".wav"
+			first := flag.Arg(0)
+			*wavFile = strings.TrimSuffix(first, filepath.Ext(first)) + ".wav"
 		}
 		audioOut, err = createWAVOutput(*wavFile)
 	case "null":
@@ -124,35 +251,199 @@ func main() {
 	}
 
 	// Open audio output
-	if err := audioOut.Open(*sampleRate, 1, *bufferSize); err != nil {
+	if err := audioOut.Open(*sampleRate, 2, *bufferSize); err != nil {
 		log.Fatalf("Failed to open audio output: %v", err)
 	}
 	defer audioOut.Close()
 
+	// Setup signal handling
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	for i, t := range tunes {
+		if len(tunes) > 1 {
+			fmt.Printf("[%d/%d] ", i+1, len(tunes))
+		}
+		if !playTune(t, audioOut, sigChan) {
+			return
+		}
+	}
+}
+
+// collectTunes reads the files given on the command line, expanding archives
+func collectTunes(args []string) ([]tune, error) {
+	var tunes []tune
+	for _, arg := range args {
+		// Check if file exists
+		if _, err := os.Stat(arg); os.IsNotExist(err) {
+			return nil, fmt.Errorf("file not found: %s", arg)
+		}
+
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+
+		// Un fichier .ym compressé est lui-même une archive LHA d'un seul membre
+		if stsound.IsYMFileName(arg) || !archive.IsArchive(data) {
+			tunes = append(tunes, tune{name: arg, data: data})
+			continue
+		}
+
+		arc, err := archive.NewReader(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open archive %s: %w", arg, err)
+		}
+		for _, name := range arc.Tunes() {
+			member, err := arc.ReadFile(name)
+			if err != nil {
+				log.Printf("Skipping %s in %s: %v", name, arg, err)
+				continue
+			}
+			tunes = append(tunes, tune{name: arg + ":" + name, data: member})
+		}
+	}
+	return tunes, nil
+}
+
+func loadTune(t tune) (*stsound.StSound, *stsound.YmMusicInfo, error) {
+	format, compressed, err := stsound.GetYMInfo(t.data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: failed to identify file format: %v", t.name, err)
+	}
+
+	fmt.Printf("File format: %s", format)
+	if compressed {
+		fmt.Printf(" (compressed)")
+	}
+	fmt.Printf("\n")
+
+	// Create YM player
+	player := stsound.CreateWithRate(*sampleRate)
+	player.SetMachine(machine)
+	player.SetCore(core)
+	player.SetChipModel(chipModel)
+	player.SetMixModel(mixModel)
+	player.SetMixTable(mixTable)
+	player.SetLoopPolicy(loopPolicy)
+
+	// Load YM file
+	fmt.Printf("Loading %s...\n", filepath.Base(t.name))
+	if machine != nil {
+		fmt.Printf("Machine: %s\n", machine.Name)
+	}
+	if err := player.LoadMemory(t.data); err != nil {
+		player.Destroy()
+		return nil, nil, fmt.Errorf("%s: %v", t.name, err)
+	}
+
+	musicInfo := player.GetInfo()
+	if *autoStop {
+		detectEnd(t, musicInfo)
+	}
+	return player, musicInfo, nil
+}
+
+// detectEnd shortens the duration of musicInfo to the end of the tune found
+// by the analyzer, playback stops there with -autostop
+func detectEnd(t tune, musicInfo *stsound.YmMusicInfo) {
+	end, err := stsound.AnalyzeTune(t.data, stsound.AnalyzeOptions{Machine: machine})
+	if err != nil {
+		log.Printf("%s: end detection failed: %v", t.name, err)
+		return
+	}
+
+	switch {
+	case end.Repeat:
+		fmt.Printf("Auto-stop: %s, the tune repeats from %s\n", formatDuration(end.EndInMs), formatDuration(end.LoopInMs))
+	case end.Silence:
+		fmt.Printf("Auto-stop: %s, silence follows\n", formatDuration(end.EndInMs))
+	default:
+		return
+	}
+	musicInfo.MusicTimeInMs = stsound.YmU32(end.EndInMs)
+}
+
+// endSample is the number of samples to render before stopping, -1 for the
+// whole song
+func endSample(musicInfo *stsound.YmMusicInfo) int64 {
+	if !*autoStop {
+		return -1
+	}
+	return int64(musicInfo.MusicTimeInMs) * int64(*sampleRate) / 1000
+}
+
+// setFilters applies -filter, or the default chain selected by -lowpass
+func setFilters(player *stsound.StSound) {
+	if filterStages != nil {
+		player.SetFilterChain(filterStages)
+	} else {
+		player.SetLowpassFilter(*lowpass)
+	}
+}
+
+func printInfo(musicInfo *stsound.YmMusicInfo) {
+	fmt.Printf("\n")
+	fmt.Printf("Title:    %s\n", musicInfo.SongName)
+	fmt.Printf("Author:   %s\n", musicInfo.SongAuthor)
+	fmt.Printf("Comment:  %s\n", musicInfo.SongComment)
+	fmt.Printf("Type:     %s\n", musicInfo.SongType)
+	fmt.Printf("Duration: %s\n", formatDuration(uint32(musicInfo.MusicTimeInMs)))
+	fmt.Printf("\n")
+}
+
+// playTune plays one song and returns false if the user asked to quit
+func playTune(t tune, audioOut audio.Output, sigChan chan os.Signal) bool {
+	player, musicInfo, err := loadTune(t)
+	if err != nil {
+		log.Printf("Failed to load YM file: %v", err)
+		return true
+	}
+	defer player.Destroy()
+
+	printInfo(musicInfo)
+
+	// Set options
+	player.SetLoopMode(*loop)
+	setFilters(player)
+	player.SetPanning(pans)
+	for _, voice := range mutedVoices {
+		player.MuteVoice(voice, true)
+	}
+	for _, voice := range soloedVoices {
+		player.SoloVoice(voice, true)
+	}
+
 	// Start playback
 	fmt.Printf("Playing... (Press Ctrl+C to stop)\n")
-	if *loop {
+	if *loops > 0 {
+		fmt.Printf("Loops: %d, fade-out: %s\n", *loops, *fade)
+	} else if *loop {
 		fmt.Printf("Looping enabled\n")
 	}
 	fmt.Printf("\n")
 
-	// Setup signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	// Create done channel
+	// Create done and stop channels
 	done := make(chan bool)
+	stop := make(chan bool)
 
 	// Start playback goroutine
 	go func() {
-		buffer := make([]int16, *bufferSize)
+		buffer := make([]int16, *bufferSize*2)
+		remaining := endSample(musicInfo)
 
 		player.Play()
 
 		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
 			// Generate audio
-			if !player.Compute(buffer, len(buffer)) {
-				if !*loop {
+			if !player.ComputeStereo(buffer, *bufferSize) {
+				if !*loop || *loops > 0 {
 					done <- true
 					return
 				}
@@ -174,10 +465,22 @@ func main() {
 				}
 			}
 
+			// -autostop : le dernier buffer est coupé à la fin détectée
+			out := buffer
+			if remaining >= 0 && remaining <= int64(*bufferSize) {
+				out = buffer[:2*remaining]
+			}
+
 			// Write to output
-			if err := audioOut.Write(buffer); err != nil {
+			if err := audioOut.Write(out); err != nil {
 				log.Printf("Audio write error: %v", err)
 			}
+			if remaining >= 0 {
+				if remaining -= int64(*bufferSize); remaining <= 0 {
+					done <- true
+					return
+				}
+			}
 		}
 	}()
 
@@ -188,12 +491,13 @@ func main() {
 	for {
 		select {
 		case <-sigChan:
+			close(stop)
 			fmt.Printf("\n\nStopping...\n")
-			return
+			return false
 
 		case <-done:
 			fmt.Printf("\n\nPlayback finished.\n")
-			return
+			return true
 
 		case <-ticker.C:
 			// Update progress
@@ -212,6 +516,82 @@ func main() {
 	}
 }
 
+// exportMultitrack renders a tune once, writing one mono WAV file per voice
+func exportMultitrack(t tune) error {
+	player, musicInfo, err := loadTune(t)
+	if err != nil {
+		return err
+	}
+	defer player.Destroy()
+
+	setFilters(player)
+	for _, voice := range mutedVoices {
+		player.MuteVoice(voice, true)
+	}
+	for _, voice := range soloedVoices {
+		player.SoloVoice(voice, true)
+	}
+
+	// Les pistes sont écrites à côté du fichier (ou de l'archive) d'origine
+	base := t.name
+	if archivePath, member, ok := strings.Cut(t.name, ":"); ok {
+		base = filepath.Join(filepath.Dir(archivePath), filepath.Base(member))
+	}
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+
+	names := []string{base + "_A.wav", base + "_B.wav", base + "_C.wav"}
+	if *withMix {
+		names = append(names, base+"_mix.wav")
+	}
+
+	outputs := make([]*WAVOutput, len(names))
+	for i, name := range names {
+		out, err := NewWAVOutput(name)
+		if err == nil {
+			err = out.Open(*sampleRate, 1, *bufferSize)
+		}
+		if err != nil {
+			return err // Les sorties déjà ouvertes sont fermées par leur defer
+		}
+		outputs[i] = out
+		defer out.Close()
+	}
+
+	var tracks [3][]int16
+	for i := range tracks {
+		tracks[i] = make([]int16, *bufferSize)
+	}
+	var mix []int16
+	if *withMix {
+		mix = make([]int16, *bufferSize)
+	}
+
+	fmt.Printf("Exporting %s (%s)...\n", musicInfo.SongName, formatDuration(uint32(musicInfo.MusicTimeInMs)))
+	remaining := endSample(musicInfo)
+	player.Play()
+	for remaining != 0 && player.ComputeMultitrack(tracks, mix, *bufferSize) {
+		n := *bufferSize
+		if remaining >= 0 {
+			n = int(min(remaining, int64(n)))
+			remaining -= int64(n)
+		}
+		for i, out := range outputs {
+			buffer := mix
+			if i < len(tracks) {
+				buffer = tracks[i]
+			}
+			if err := out.Write(buffer[:n]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range names {
+		fmt.Printf("Wrote %s\n", name)
+	}
+	return nil
+}
+
 func createWAVOutput(filename string) (audio.Output, error) {
 	return NewWAVOutput(filename)
 }
@@ -239,9 +619,14 @@ func makeProgressBar(percent float64, width int) string {
 }
 
 // NullOutput discards all audio
-type NullOutput struct{}
+type NullOutput struct {
+	sampleRate int
+	channels   int
+}
 
 func (n *NullOutput) Open(sampleRate, channels, bufferSize int) error {
+	n.sampleRate = sampleRate
+	n.channels = channels
 	return nil
 }
 
@@ -251,7 +636,7 @@ func (n *NullOutput) Close() error {
 
 func (n *NullOutput) Write(samples []int16) error {
 	// Simulate write delay
-	duration := time.Duration(len(samples)) * time.Second / time.Duration(44100)
+	duration := time.Duration(len(samples)/n.channels) * time.Second / time.Duration(n.sampleRate)
 	time.Sleep(duration)
 	return nil
 }
@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/olivierh59500/ym-player/pkg/lzh"
+)
+
+// Format identifies the container type of an archive
+type Format int
+
+const (
+	FormatLHA Format = iota
+	FormatZIP
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatLHA:
+		return "LHA"
+	case FormatZIP:
+		return "ZIP"
+	}
+	return "unknown"
+}
+
+var (
+	ErrUnknownFormat = errors.New("unknown archive format")
+	ErrNotFound      = errors.New("entry not found in archive")
+	ErrTooLarge      = errors.New("archive entry too large")
+)
+
+// Entry describes one member of an archive
+type Entry struct {
+	Name       string
+	Size       int64
+	PackedSize int64
+	Method     string // "-lh5-", "deflate", ...
+	ModTime    time.Time
+	IsDir      bool
+}
+
+// Archive gives access to the members of an LHA or ZIP archive held in memory
+type Archive struct {
+	Format  Format
+	Entries []Entry
+
+	lhaFiles []*lzh.File
+	zipFiles []*zip.File
+}
+
+// Open reads and indexes an archive file
+func Open(filename string) (*Archive, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(data)
+}
+
+// NewReader indexes the archive stored in data
+func NewReader(data []byte) (*Archive, error) {
+	if IsZIP(data) {
+		return newZIPArchive(data)
+	}
+	if lzh.IsLZHCompressed(data) {
+		return newLHAArchive(data)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// IsArchive reports whether data starts like an LHA or ZIP archive
+func IsArchive(data []byte) bool {
+	return IsZIP(data) || lzh.IsLZHCompressed(data)
+}
+
+// IsZIP checks for a local file header or an empty archive signature
+func IsZIP(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06"))
+}
+
+func newLHAArchive(data []byte) (*Archive, error) {
+	r, err := lzh.NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{Format: FormatLHA, lhaFiles: r.File}
+	for _, f := range r.File {
+		a.Entries = append(a.Entries, Entry{
+			Name:       f.Name,
+			Size:       int64(f.OriginalSize),
+			PackedSize: int64(f.PackedSize),
+			Method:     f.Method,
+			ModTime:    f.ModTime,
+			IsDir:      f.IsDir(),
+		})
+	}
+	return a, nil
+}
+
+func newZIPArchive(data []byte) (*Archive, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{Format: FormatZIP, zipFiles: r.File}
+	for _, f := range r.File {
+		a.Entries = append(a.Entries, Entry{
+			Name:       f.Name,
+			Size:       int64(f.UncompressedSize64),
+			PackedSize: int64(f.CompressedSize64),
+			Method:     zipMethodName(f.Method),
+			ModTime:    f.Modified,
+			IsDir:      f.FileInfo().IsDir(),
+		})
+	}
+	return a, nil
+}
+
+func zipMethodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "stored"
+	case zip.Deflate:
+		return "deflate"
+	}
+	return fmt.Sprintf("method %d", method)
+}
+
+// ReadEntry unpacks the i-th member. ZIP members are bounded like LHA ones
+// by lzh.MaxOriginalSize, whatever size their header announces.
+func (a *Archive) ReadEntry(i int) ([]byte, error) {
+	if i < 0 || i >= len(a.Entries) {
+		return nil, fmt.Errorf("entry index %d out of range", i)
+	}
+
+	if a.Format == FormatLHA {
+		return a.lhaFiles[i].Read()
+	}
+
+	rc, err := a.zipFiles[i].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	// Un octet de plus que la limite suffit à détecter un membre trop grand
+	limit := int64(lzh.MaxOriginalSize)
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s is over %d bytes", ErrTooLarge, a.Entries[i].Name, limit)
+	}
+	return data, nil
+}
+
+// ReadFile unpacks the member with the given name
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	for i := range a.Entries {
+		if a.Entries[i].Name == name {
+			return a.ReadEntry(i)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Tunes returns the names of the YM tunes stored in the archive.
+// A lone member is always taken as a tune (single-song .lzh files).
+func (a *Archive) Tunes() []string {
+	var names []string
+	for _, entry := range a.Entries {
+		if entry.IsDir {
+			continue
+		}
+		if strings.EqualFold(path.Ext(entry.Name), ".ym") || len(a.Entries) == 1 {
+			names = append(names, entry.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/olivierh59500/ym-player/pkg/lzh"
+)
+
+var tunes = map[string][]byte{
+	"Mad Max/Lethal Xcess.YM": bytes.Repeat([]byte("YM6!LeOnArD!"), 20),
+	"Mad Max/readme.txt":      []byte("not a tune"),
+	"Count Zero/Decade.ym":    []byte("YM5!LeOnArD!"),
+}
+
+func TestZIPTunes(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	w.Create("Mad Max/")
+	for _, name := range []string{"Mad Max/Lethal Xcess.YM", "Mad Max/readme.txt", "Count Zero/Decade.ym"} {
+		f, _ := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		f.Write(tunes[name])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewReader(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Format != FormatZIP || len(a.Entries) != 4 || !a.Entries[0].IsDir {
+		t.Fatalf("entries: %+v", a.Entries)
+	}
+	if e := a.Entries[1]; e.Method != "deflate" || e.Size != 240 || e.PackedSize >= e.Size {
+		t.Errorf("entry %+v", e)
+	}
+	checkTunes(t, a, []string{"Mad Max/Lethal Xcess.YM", "Count Zero/Decade.ym"})
+
+	// Les membres ZIP ont la même limite que les membres LHA
+	defer func(max uint32) { lzh.MaxOriginalSize = max }(lzh.MaxOriginalSize)
+	lzh.MaxOriginalSize = 239
+	if _, err := a.ReadEntry(1); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("entry over the limit: %v, want ErrTooLarge", err)
+	}
+	lzh.MaxOriginalSize = 240
+	if data, err := a.ReadEntry(1); err != nil || len(data) != 240 {
+		t.Errorf("entry at the limit: %d bytes, %v", len(data), err)
+	}
+}
+
+func TestLHATunes(t *testing.T) {
+	// Plusieurs membres : les archives d'un membre chacune mises bout à bout
+	var data []byte
+	for _, name := range []string{"Mad Max/Lethal Xcess.YM", "Mad Max/readme.txt", "Count Zero/Decade.ym"} {
+		member, err := lzh.Compress(name, tunes[name], time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, member[:len(member)-1]...)
+	}
+	data = append(data, 0)
+
+	a, err := NewReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Format != FormatLHA || len(a.Entries) != 3 {
+		t.Fatalf("entries: %+v", a.Entries)
+	}
+	if e := a.Entries[0]; e.Method != "-lh5-" || e.Size != 240 || a.Entries[2].Method != "-lh0-" {
+		t.Errorf("entries: %+v", a.Entries)
+	}
+	checkTunes(t, a, []string{"Mad Max/Lethal Xcess.YM", "Count Zero/Decade.ym"})
+
+	// Un membre seul est un morceau, quel que soit son nom
+	single, _ := lzh.Compress("lethal.bin", tunes["Mad Max/Lethal Xcess.YM"], time.Time{})
+	if a, err = NewReader(single); err != nil {
+		t.Fatal(err)
+	}
+	if names := a.Tunes(); !slices.Equal(names, []string{"lethal.bin"}) {
+		t.Errorf("single member: tunes %v", names)
+	}
+
+	if _, err := NewReader([]byte("YM6!LeOnArD!")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("plain YM file: %v, want ErrUnknownFormat", err)
+	}
+}
+
+func checkTunes(t *testing.T, a *Archive, want []string) {
+	t.Helper()
+	names := a.Tunes()
+	if !slices.Equal(names, want) {
+		t.Errorf("tunes %v, want %v", names, want)
+	}
+	for _, name := range names {
+		if data, err := a.ReadFile(name); err != nil || !bytes.Equal(data, tunes[name]) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := a.ReadFile("missing.ym"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing member: %v, want ErrNotFound", err)
+	}
+}
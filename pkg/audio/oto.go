@@ -198,10 +198,11 @@ func (f *FallbackOutput) Write(samples []int16) error {
 		return fmt.Errorf("output closed")
 	}
 	sampleRate := f.sampleRate
+	channels := f.channels
 	f.mu.Unlock()
 
 	// Calculate duration and sleep
-	duration := time.Duration(len(samples)) * time.Second / time.Duration(sampleRate)
+	duration := time.Duration(len(samples)/channels) * time.Second / time.Duration(sampleRate)
 	time.Sleep(duration)
 	return nil
 }
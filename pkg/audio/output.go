@@ -2,7 +2,7 @@ package audio
 
 import (
 	"errors"
-	"reflect"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -15,24 +15,50 @@ type Output interface {
 	IsPlaying() bool
 }
 
+// Source renders mono samples, as *stsound.StSound does
+type Source interface {
+	Compute(buffer []int16, nbSamples int) bool
+}
+
+// StereoSource renders nbSamples interleaved left/right pairs
+type StereoSource interface {
+	ComputeStereo(buffer []int16, nbSamples int) bool
+}
+
+// ErrNoSource is returned by Start when the player cannot render the
+// requested number of channels
+var ErrNoSource = errors.New("player cannot render the requested channels")
+
 // Player wraps the YM player with audio output
 type Player struct {
 	stSound    interface{} // *stsound.StSound
+	compute    func(buffer []int16, nbSamples int) bool
 	output     Output
 	sampleRate int
 	bufferSize int
+	channels   int
 	playing    bool
 	paused     bool
 	mu         sync.Mutex
 	done       chan bool
 }
 
-// NewPlayer creates a new audio player
+// NewPlayer creates a new audio player (stereo output)
 func NewPlayer(stSound interface{}, output Output) *Player {
 	return &Player{
-		stSound: stSound,
-		output:  output,
-		done:    make(chan bool),
+		stSound:  stSound,
+		output:   output,
+		channels: 2,
+		done:     make(chan bool),
+	}
+}
+
+// SetChannels selects mono (1) or stereo (2) rendering, before Start
+func (p *Player) SetChannels(channels int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if channels == 1 || channels == 2 {
+		p.channels = channels
 	}
 }
 
@@ -45,11 +71,25 @@ func (p *Player) Start(sampleRate, bufferSize int) error {
 		return errors.New("already playing")
 	}
 	
+	if p.channels == 2 {
+		source, ok := p.stSound.(StereoSource)
+		if !ok {
+			return fmt.Errorf("%w: %T has no ComputeStereo", ErrNoSource, p.stSound)
+		}
+		p.compute = source.ComputeStereo
+	} else {
+		source, ok := p.stSound.(Source)
+		if !ok {
+			return fmt.Errorf("%w: %T has no Compute", ErrNoSource, p.stSound)
+		}
+		p.compute = source.Compute
+	}
+
 	p.sampleRate = sampleRate
 	p.bufferSize = bufferSize
 	
 	// Open audio output
-	if err := p.output.Open(sampleRate, 1, bufferSize); err != nil {
+	if err := p.output.Open(sampleRate, p.channels, bufferSize); err != nil {
 		return err
 	}
 	
@@ -103,11 +143,7 @@ func (p *Player) audioLoop() {
 		p.done <- true
 	}()
 	
-	buffer := make([]int16, p.bufferSize)
-	
-	// Use reflection to call Compute method
-	// In real implementation, use proper type assertion
-	computeMethod := reflect.ValueOf(p.stSound).MethodByName("Compute")
+	buffer := make([]int16, p.bufferSize*p.channels)
 	
 	for {
 		p.mu.Lock()
@@ -124,15 +160,8 @@ func (p *Player) audioLoop() {
 				buffer[i] = 0
 			}
 		} else {
-			// Compute next audio samples
-			args := []reflect.Value{
-				reflect.ValueOf(buffer),
-				reflect.ValueOf(len(buffer)),
-			}
-			result := computeMethod.Call(args)
-			
-			// Check if music is over
-			if !result[0].Bool() {
+			// Compute next audio samples, stop when the music is over
+			if !p.compute(buffer, p.bufferSize) {
 				p.mu.Lock()
 				p.playing = false
 				p.mu.Unlock()
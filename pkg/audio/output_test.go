@@ -0,0 +1,75 @@
+package audio
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// monoSource only renders mono, like a player without stereo support
+type monoSource struct{}
+
+func (monoSource) Compute(buffer []int16, nbSamples int) bool {
+	for i := range buffer[:nbSamples] {
+		buffer[i] = 1
+	}
+	return true
+}
+
+// stereoSource renders left at 1 and right at 2
+type stereoSource struct{ monoSource }
+
+func (stereoSource) ComputeStereo(buffer []int16, nbSamples int) bool {
+	for i := 0; i < nbSamples; i++ {
+		buffer[2*i], buffer[2*i+1] = 1, 2
+	}
+	return true
+}
+
+func TestPlayerSources(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		source   interface{}
+		channels int
+		err      error
+	}{
+		{"mono", monoSource{}, 1, nil},
+		{"stereo", stereoSource{}, 2, nil},
+		{"mono source in stereo", monoSource{}, 2, ErrNoSource},
+		{"not a source", "song.ym", 1, ErrNoSource},
+	} {
+		output := NewBufferOutput()
+		p := NewPlayer(tc.source, output)
+		p.SetChannels(tc.channels)
+		err := p.Start(44100, 256)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%s: %v, want %v", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		var samples []int16
+		for deadline := time.Now().Add(5 * time.Second); len(samples) < 4*256 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+			samples = output.GetBuffer()
+		}
+		p.Stop()
+
+		if len(samples) < 4*256 {
+			t.Fatalf("%s: %d samples rendered", tc.name, len(samples))
+		}
+		for i, s := range samples {
+			want := int16(1)
+			if tc.channels == 2 && i%2 == 1 {
+				want = 2
+			}
+			if s != want {
+				t.Fatalf("%s: sample %d = %d, want %d", tc.name, i, s, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package lzh
+
+// File is one member of an LHA archive
+type File struct {
+	Header
+	packed []byte
+}
+
+// Read unpacks the member and checks its CRC
+func (f *File) Read() ([]byte, error) {
+	return f.Header.Decode(f.packed)
+}
+
+// Reader lists the members of an LHA archive held in memory
+type Reader struct {
+	File []*File
+}
+
+// NewReader walks every header of an LHA archive. Data before the first
+// header (self-extracting stub) is skipped.
+func NewReader(data []byte) (*Reader, error) {
+	pos := findHeader(data)
+	if pos < 0 {
+		return nil, ErrHeaderNotFound
+	}
+
+	r := &Reader{}
+	// Un octet nul marque la fin de l'archive
+	for pos < len(data) && data[pos] != 0 {
+		header, err := ParseHeader(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+
+		start := pos + header.HeaderSize
+		if uint64(len(data)-start) < uint64(header.PackedSize) {
+			return nil, ErrTruncated
+		}
+		end := start + int(header.PackedSize)
+
+		r.File = append(r.File, &File{Header: *header, packed: data[start:end]})
+		pos = end
+	}
+	return r, nil
+}
@@ -0,0 +1,32 @@
+package lzh
+
+// CRC-16 as used by LHA (polynomial 0xA001, reflected, initial value 0)
+var crc16Table = makeCRC16Table()
+
+func makeCRC16Table() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		r := uint16(i)
+		for j := 0; j < CHAR_BIT; j++ {
+			if r&1 != 0 {
+				r = (r >> 1) ^ 0xA001
+			} else {
+				r >>= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}
+
+// CRC16 computes the LHA checksum of data
+func CRC16(data []byte) uint16 {
+	return updateCRC16(0, data)
+}
+
+func updateCRC16(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc = crc16Table[byte(crc)^b] ^ (crc >> 8)
+	}
+	return crc
+}
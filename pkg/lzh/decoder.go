@@ -2,13 +2,10 @@ package lzh
 
 import (
 	"bytes"
-	"encoding/binary"
-	"errors"
 	"fmt"
-	"io"
 )
 
-// LZH constants from original C++ code
+// LZH constants from original C++ code (DICBIT, NP and PBIT are the -lh5- values)
 const (
 	CHAR_BIT  = 8
 	UCHAR_MAX = 255
@@ -26,8 +23,15 @@ const (
 	TBIT      = 5
 	NPT       = NT // NT > NP
 	BUFSIZE   = 4096
+
+	// A valid stream is never read more than a few bytes past its end
+	MAXOVERRUN = 4
 )
 
+// MaxOriginalSize bounds the unpacked size announced by a header, so that a
+// forged header cannot make Decompress allocate gigabytes
+var MaxOriginalSize uint32 = 256 << 20
+
 // Decoder structure
 type Decoder struct {
 	// Input/Output
@@ -50,116 +54,118 @@ type Decoder struct {
 	c_table  [4096]uint16
 	pt_table [256]uint16
 
+	// Bytes fed past the end of the input, and first corruption found
+	overrun int
+	err     error
+
+	// Method parameters
+	dicsiz uint32
+	np     int
+	pbit   int
+
 	// Decode state
 	blocksize uint16
 	decode_j  int
 	decode_i  uint32
-	outbuf    [DICSIZ]uint8
+	outbuf    []uint8
+}
+
+// Paramètres des méthodes -lhX-: taille du dictionnaire et codage des positions
+type methodParams struct {
+	dicbit int
+	np     int
+	pbit   int
+}
+
+var lhMethods = map[string]methodParams{
+	"-lh4-": {12, 14, 4},
+	"-lh5-": {13, 14, 4},
+	"-lh6-": {15, 16, 5},
+	"-lh7-": {16, 17, 5},
 }
 
-// Decompress decompresses LH5 compressed data
+// Decompress decompresses the first member of an LHA archive
 func Decompress(data []byte) ([]byte, error) {
 	if len(data) < 7 {
-		return nil, errors.New("data too small")
-	}
-
-	// Find LZH header by looking for -lhX- pattern
-	headerStart := -1
-	for i := 0; i <= len(data)-7; i++ {
-		if data[i+2] == '-' && data[i+3] == 'l' && data[i+4] == 'h' && data[i+6] == '-' {
-			headerStart = i
-			break
-		}
+		return nil, fmt.Errorf("%w: data too small", ErrTruncated)
 	}
 
+	headerStart := findHeader(data)
 	if headerStart < 0 {
-		return nil, errors.New("LZH header not found")
+		return nil, ErrHeaderNotFound
 	}
 
-	reader := bytes.NewReader(data[headerStart:])
-
-	// Read header
-	var header struct {
-		HeaderSize   uint8
-		HeaderSum    uint8
-		Method       [5]uint8
-		PackedSize   uint32
-		OriginalSize uint32
-		FileTime     uint32
-		Attribute    uint8
-		Level        uint8
-	}
-
-	// Read header size
-	if err := binary.Read(reader, binary.LittleEndian, &header.HeaderSize); err != nil {
+	header, err := ParseHeader(data[headerStart:])
+	if err != nil {
 		return nil, err
 	}
 
-	// Read header checksum
-	if err := binary.Read(reader, binary.LittleEndian, &header.HeaderSum); err != nil {
-		return nil, err
+	packed := data[headerStart+header.HeaderSize:]
+	if uint64(len(packed)) < uint64(header.PackedSize) {
+		return nil, ErrTruncated
 	}
+	return header.Decode(packed[:header.PackedSize])
+}
 
-	// Read method
-	if _, err := reader.Read(header.Method[:]); err != nil {
-		return nil, err
+// findHeader returns the offset of the first header, looking for the -lhX- pattern
+func findHeader(data []byte) int {
+	for i := 0; i <= len(data)-7; i++ {
+		if data[i+2] == '-' && data[i+3] == 'l' && data[i+4] == 'h' && data[i+6] == '-' {
+			return i
+		}
 	}
+	return -1
+}
 
-	methodStr := string(header.Method[:])
-	if methodStr != "-lh5-" && methodStr != "-lh4-" && methodStr != "-lh0-" {
-		return nil, fmt.Errorf("unsupported method: %s", methodStr)
-	}
+// Decode unpacks the member data that follows the header and checks its CRC
+func (h *Header) Decode(packed []byte) ([]byte, error) {
+	var output []byte
 
-	// Read sizes
-	if err := binary.Read(reader, binary.LittleEndian, &header.PackedSize); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &header.OriginalSize); err != nil {
-		return nil, err
+	if h.OriginalSize > MaxOriginalSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, h.OriginalSize)
 	}
 
-	// Skip the rest of the header
-	// We've read: 1 + 1 + 5 + 4 + 4 = 15 bytes
-	// Total header size is HeaderSize + 2
-	toSkip := int(header.HeaderSize) + 2 - 15
-	if toSkip > 0 {
-		if _, err := reader.Seek(int64(toSkip), 1); err != nil {
-			return nil, err
+	if h.Method == "-lh0-" {
+		// For -lh0-, data is uncompressed
+		if uint64(len(packed)) < uint64(h.OriginalSize) {
+			return nil, fmt.Errorf("%w: got %d, expected %d", ErrTruncated, len(packed), h.OriginalSize)
+		}
+		output = make([]byte, h.OriginalSize)
+		copy(output, packed)
+	} else {
+		params, ok := lhMethods[h.Method]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedMethod, h.Method)
 		}
-	}
 
-	// For -lh0-, data is uncompressed
-	if methodStr == "-lh0-" {
-		output := make([]byte, header.OriginalSize)
-		n, err := reader.Read(output)
-		if err != nil && err != io.EOF {
+		decoder := newDecoder(params, packed, int(h.OriginalSize))
+		if err := decoder.decode(int(h.OriginalSize)); err != nil {
 			return nil, err
 		}
-		if n != int(header.OriginalSize) {
-			return nil, fmt.Errorf("incomplete data: got %d, expected %d", n, header.OriginalSize)
-		}
-		return output, nil
+		output = decoder.output.Bytes()
 	}
 
-	// Read compressed data
-	compressedData := make([]byte, header.PackedSize)
-	n, err := reader.Read(compressedData)
-	if err != nil && err != io.EOF {
-		return nil, err
+	if h.HasCRC {
+		if crc := CRC16(output); crc != h.CRC {
+			return nil, &CRCError{Name: h.Name, Expected: h.CRC, Actual: crc}
+		}
 	}
+	return output, nil
+}
 
-	// Create decoder
-	decoder := &Decoder{
-		input:  bytes.NewReader(compressedData[:n]),
-		output: bytes.NewBuffer(make([]byte, 0, header.OriginalSize)),
+func newDecoder(params methodParams, packed []byte, origSize int) *Decoder {
+	// La taille annoncée n'est pas fiable tant que le flux n'est pas décodé
+	if origSize > 1<<20 {
+		origSize = 1 << 20
 	}
-
-	// Decode
-	if err := decoder.decode(int(header.OriginalSize)); err != nil {
-		return nil, err
+	return &Decoder{
+		input:  bytes.NewReader(packed),
+		output: bytes.NewBuffer(make([]byte, 0, origSize)),
+		dicsiz: 1 << params.dicbit,
+		np:     params.np,
+		pbit:   params.pbit,
+		outbuf: make([]uint8, 1<<params.dicbit),
 	}
-
-	return decoder.output.Bytes(), nil
 }
 
 func (d *Decoder) fillbuf(n int) {
@@ -180,6 +186,7 @@ func (d *Decoder) fillbuf(n int) {
 			d.fillbuf_i++
 		} else {
 			d.subbitbuf = 0
+			d.overrun++
 		}
 		d.bitcount = CHAR_BIT
 	}
@@ -221,8 +228,11 @@ func (d *Decoder) make_table(nchar int, bitlen []uint8, tablebits int, table []u
 	for i := 1; i <= 16; i++ {
 		start[i+1] = start[i] + (count[i] << (16 - i))
 	}
-	// Check for valid table - in the C++ code, this returns 1 for error
-	// but we'll just continue as the C++ code doesn't check the return value
+	// Le code doit être complet (sinon "Bad table" dans le code C)
+	if start[17] != 0 {
+		d.setError(fmt.Errorf("%w: bad Huffman table", ErrCorrupt))
+		return
+	}
 
 	// Assign weights
 	jutbits := 16 - tablebits
@@ -297,9 +307,17 @@ func (d *Decoder) make_table(nchar int, bitlen []uint8, tablebits int, table []u
 
 func (d *Decoder) read_pt_len(nn, nbit, i_special int) {
 	n := d.getbits(nbit)
+	if int(n) > nn {
+		d.setError(fmt.Errorf("%w: bad table size", ErrCorrupt))
+		return
+	}
 
 	if n == 0 {
 		c := d.getbits(nbit)
+		if int(c) >= nn {
+			d.setError(fmt.Errorf("%w: bad table code", ErrCorrupt))
+			return
+		}
 		for i := 0; i < nn; i++ {
 			d.pt_len[i] = 0
 		}
@@ -324,11 +342,19 @@ func (d *Decoder) read_pt_len(nn, nbit, i_special int) {
 				fillLen = c - 3
 			}
 			d.fillbuf(fillLen)
+			if c > 16 {
+				d.setError(fmt.Errorf("%w: bad code length", ErrCorrupt))
+				return
+			}
 			d.pt_len[i] = uint8(c)
 			i++
 
 			if i == i_special {
 				c := d.getbits(2)
+				if i+int(c) > nn {
+					d.setError(fmt.Errorf("%w: bad table size", ErrCorrupt))
+					return
+				}
 				for c > 0 {
 					d.pt_len[i] = 0
 					i++
@@ -346,9 +372,17 @@ func (d *Decoder) read_pt_len(nn, nbit, i_special int) {
 
 func (d *Decoder) read_c_len() {
 	n := d.getbits(CBIT)
+	if n > NC {
+		d.setError(fmt.Errorf("%w: bad table size", ErrCorrupt))
+		return
+	}
 
 	if n == 0 {
 		c := d.getbits(CBIT)
+		if c >= NC {
+			d.setError(fmt.Errorf("%w: bad table code", ErrCorrupt))
+			return
+		}
 		for i := 0; i < NC; i++ {
 			d.c_len[i] = 0
 		}
@@ -380,6 +414,10 @@ func (d *Decoder) read_c_len() {
 				} else {
 					c = d.getbits(CBIT) + 20
 				}
+				if i+int(c) > NC {
+					d.setError(fmt.Errorf("%w: bad table size", ErrCorrupt))
+					return
+				}
 				for c > 0 {
 					d.c_len[i] = 0
 					i++
@@ -403,7 +441,10 @@ func (d *Decoder) decode_c() uint16 {
 		d.blocksize = d.getbits(16)
 		d.read_pt_len(NT, TBIT, 3)
 		d.read_c_len()
-		d.read_pt_len(NP, PBIT, -1)
+		d.read_pt_len(d.np, d.pbit, -1)
+		if d.err != nil {
+			return 0
+		}
 	}
 	d.blocksize--
 
@@ -425,9 +466,9 @@ func (d *Decoder) decode_c() uint16 {
 
 func (d *Decoder) decode_p() uint16 {
 	j := d.pt_table[d.bitbuf>>(BITBUFSIZ-8)]
-	if j >= NP {
+	if int(j) >= d.np {
 		mask := uint16(1 << (BITBUFSIZ - 1 - 8))
-		for j >= NP {
+		for int(j) >= d.np {
 			if (d.bitbuf & mask) != 0 {
 				j = d.right[j]
 			} else {
@@ -452,12 +493,18 @@ func (d *Decoder) decode(origSize int) error {
 
 	for origSize > 0 {
 		count := origSize
-		if count > DICSIZ {
-			count = DICSIZ
+		if count > int(d.dicsiz) {
+			count = int(d.dicsiz)
 		}
 
 		// Decode into buffer
 		d.decodeBuffer(count)
+		if d.err != nil {
+			return d.err
+		}
+		if d.overrun > MAXOVERRUN {
+			return ErrTruncated
+		}
 
 		// Write to output
 		if _, err := d.output.Write(d.outbuf[:count]); err != nil {
@@ -470,18 +517,28 @@ func (d *Decoder) decode(origSize int) error {
 	return nil
 }
 
+// setError keeps the first corruption found, decoding stops on it
+func (d *Decoder) setError(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
 func (d *Decoder) decodeBuffer(count int) {
 	r := uint32(0)
 
 	for d.decode_j > 0 && r < uint32(count) {
 		d.outbuf[r] = d.outbuf[d.decode_i]
-		d.decode_i = (d.decode_i + 1) & (DICSIZ - 1)
+		d.decode_i = (d.decode_i + 1) & (d.dicsiz - 1)
 		r++
 		d.decode_j--
 	}
 
 	for r < uint32(count) {
 		c := d.decode_c()
+		if d.err != nil {
+			return
+		}
 
 		if c <= UCHAR_MAX {
 			d.outbuf[r] = uint8(c)
@@ -489,11 +546,11 @@ func (d *Decoder) decodeBuffer(count int) {
 		} else {
 			d.decode_j = int(c) - (UCHAR_MAX + 1 - THRESHOLD)
 			p := d.decode_p()
-			d.decode_i = (r - uint32(p) - 1) & (DICSIZ - 1)
+			d.decode_i = (r - uint32(p) - 1) & (d.dicsiz - 1)
 
 			for d.decode_j > 0 && r < uint32(count) {
 				d.outbuf[r] = d.outbuf[d.decode_i]
-				d.decode_i = (d.decode_i + 1) & (DICSIZ - 1)
+				d.decode_i = (d.decode_i + 1) & (d.dicsiz - 1)
 				r++
 				d.decode_j--
 			}
@@ -0,0 +1,50 @@
+package lzh
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func FuzzDecompress(f *testing.F) {
+	data := bytes.Repeat([]byte("YM6!LeOnArD!\x00\x01\x02\x03 register stream "), 64)
+	archive, err := Compress("song.ym", data, time.Time{})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(archive)
+	f.Add(archive[:len(archive)/2])
+
+	// Membre -lh0- (stocké) avec en-tête de niveau 0
+	stored := []byte("\x16\x00-lh0-\x04\x00\x00\x00\x04\x00\x00\x00\x00\x00\x00\x00\x20\x00\x00\x00\x00YM6!\x00")
+	crc := CRC16([]byte("YM6!"))
+	stored[22], stored[23] = byte(crc), byte(crc>>8)
+	stored[1] = headerChecksum(stored[2:24])
+	f.Add(stored)
+
+	// Limite les allocations demandées par des en-têtes forgés
+	maxSize := MaxOriginalSize
+	MaxOriginalSize = 1 << 20
+	f.Cleanup(func() { MaxOriginalSize = maxSize })
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		out, err := Decompress(data)
+		if err != nil {
+			return
+		}
+
+		header, err := ParseHeader(data[findHeader(data):])
+		if err != nil {
+			t.Fatalf("Decompress succeeded on an unparsable header: %v", err)
+		}
+		if len(out) != int(header.OriginalSize) {
+			t.Fatalf("got %d bytes, header announces %d", len(out), header.OriginalSize)
+		}
+
+		if r, err := NewReader(data); err == nil {
+			for _, file := range r.File {
+				file.Read()
+			}
+		}
+	})
+}
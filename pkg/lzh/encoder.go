@@ -0,0 +1,519 @@
+package lzh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Encoder tuning
+const (
+	HASHBIT   = 15
+	HASHSIZ   = 1 << HASHBIT
+	MAXCHAIN  = 256
+	BLOCKSIZ  = 1 << 14 // Codes per Huffman block (must fit in 16 bits)
+	MAXNAMELN = 255 - 22
+)
+
+type lzToken struct {
+	c uint16 // Literal or length code
+	p uint16 // Match position (distance - 1)
+}
+
+// Encoder structure
+type Encoder struct {
+	output *bytes.Buffer
+	params methodParams
+
+	// Bit buffer
+	bitbuf   uint32
+	bitcount int
+
+	// Match finder
+	head [HASHSIZ]int32
+	prev []int32
+
+	// Current block
+	tokens []lzToken
+	c_freq [NC]int
+	p_freq [NPT]int // NPT > np of every method
+	t_freq [NT]int
+
+	// Huffman codes
+	c_len   [NC]uint8
+	pt_len  [NPT]uint8
+	c_code  [NC]uint16
+	pt_code [NPT]uint16
+}
+
+// Compress packs data as a single-member LHA level-0 archive using -lh5-.
+// Like LHa, the member is stored as -lh0- when packing does not shrink it.
+func Compress(name string, data []byte, modTime time.Time) ([]byte, error) {
+	if len(name) > MAXNAMELN {
+		return nil, fmt.Errorf("file name too long: %d bytes", len(name))
+	}
+	if uint64(len(data)) > 0xffffffff {
+		return nil, errors.New("data too large for LHA archive")
+	}
+
+	method, packed := "-lh5-", EncodeLH5(data)
+	if len(packed) >= len(data) {
+		method, packed = "-lh0-", data
+	}
+	if uint64(len(packed)) > 0xffffffff {
+		return nil, errors.New("packed data too large for LHA archive")
+	}
+
+	// Level-0 header: the first two bytes are the header size and checksum
+	headerSize := 22 + len(name)
+	header := make([]byte, headerSize+2)
+	header[0] = uint8(headerSize)
+	copy(header[2:7], method)
+	binary.LittleEndian.PutUint32(header[7:11], uint32(len(packed)))
+	binary.LittleEndian.PutUint32(header[11:15], uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[15:19], dosTime(modTime))
+	header[19] = 0x20 // Archive attribute
+	header[20] = 0    // Level 0
+	header[21] = uint8(len(name))
+	copy(header[22:], name)
+	binary.LittleEndian.PutUint16(header[22+len(name):], CRC16(data))
+	header[1] = headerChecksum(header[2:])
+
+	out := make([]byte, 0, len(header)+len(packed)+1)
+	out = append(out, header...)
+	out = append(out, packed...)
+	out = append(out, 0) // End of archive
+	return out, nil
+}
+
+// EncodeLH5 compresses data to a raw -lh5- bit stream
+func EncodeLH5(data []byte) []byte {
+	return encodeLH(data, lhMethods["-lh5-"])
+}
+
+// encodeLH compresses data with the dictionary and position coding of a
+// -lhX- method
+func encodeLH(data []byte, params methodParams) []byte {
+	e := &Encoder{
+		output: bytes.NewBuffer(make([]byte, 0, len(data)/2+16)),
+		params: params,
+		prev:   make([]int32, len(data)),
+	}
+	e.encode(data)
+	return e.output.Bytes()
+}
+
+func headerChecksum(header []byte) uint8 {
+	var sum uint8
+	for _, b := range header {
+		sum += b
+	}
+	return sum
+}
+
+func dosTime(t time.Time) uint32 {
+	if t.IsZero() || t.Year() < 1980 {
+		return 0
+	}
+	return uint32(t.Year()-1980)<<25 | uint32(t.Month())<<21 | uint32(t.Day())<<16 |
+		uint32(t.Hour())<<11 | uint32(t.Minute())<<5 | uint32(t.Second()/2)
+}
+
+func (e *Encoder) putbits(n int, x uint16) {
+	e.bitbuf = (e.bitbuf << n) | (uint32(x) & (1<<n - 1))
+	e.bitcount += n
+	for e.bitcount >= CHAR_BIT {
+		e.bitcount -= CHAR_BIT
+		e.output.WriteByte(byte(e.bitbuf >> e.bitcount))
+	}
+	e.bitbuf &= 1<<e.bitcount - 1
+}
+
+func (e *Encoder) flushbits() {
+	if e.bitcount > 0 {
+		e.output.WriteByte(byte(e.bitbuf << (CHAR_BIT - e.bitcount)))
+	}
+	e.bitbuf = 0
+	e.bitcount = 0
+}
+
+func hash3(data []byte, i int) int {
+	return ((int(data[i]) << 10) ^ (int(data[i+1]) << 5) ^ int(data[i+2])) & (HASHSIZ - 1)
+}
+
+func (e *Encoder) insert(data []byte, i int) {
+	if i+THRESHOLD > len(data) {
+		return
+	}
+	h := hash3(data, i)
+	e.prev[i] = e.head[h]
+	e.head[h] = int32(i)
+}
+
+func (e *Encoder) findMatch(data []byte, i int) (length, dist int) {
+	if i+THRESHOLD > len(data) {
+		return 0, 0
+	}
+	maxLen := len(data) - i
+	if maxLen > MAXMATCH {
+		maxLen = MAXMATCH
+	}
+
+	j := int(e.head[hash3(data, i)])
+	for chain := 0; j >= 0 && i-j < 1<<e.params.dicbit && chain < MAXCHAIN; chain++ {
+		if data[j+length] == data[i+length] {
+			l := 0
+			for l < maxLen && data[j+l] == data[i+l] {
+				l++
+			}
+			if l > length {
+				length, dist = l, i-j
+				if l == maxLen {
+					break
+				}
+			}
+		}
+		j = int(e.prev[j])
+	}
+	if length < THRESHOLD {
+		return 0, 0
+	}
+	return length, dist
+}
+
+func (e *Encoder) encode(data []byte) {
+	for i := range e.head {
+		e.head[i] = -1
+	}
+
+	n := len(data)
+	i := 0
+	length, dist := e.findMatch(data, 0)
+	for i < n {
+		e.insert(data, i)
+		if length >= THRESHOLD {
+			// Lazy evaluation: prefer a longer match starting at the next byte
+			if length < MAXMATCH && i+1 < n {
+				nl, nd := e.findMatch(data, i+1)
+				if nl > length {
+					e.output_c(uint16(data[i]), 0)
+					i++
+					length, dist = nl, nd
+					continue
+				}
+			}
+			e.output_c(uint16(length+UCHAR_MAX+1-THRESHOLD), uint16(dist-1))
+			for k := i + 1; k < i+length; k++ {
+				e.insert(data, k)
+			}
+			i += length
+		} else {
+			e.output_c(uint16(data[i]), 0)
+			i++
+		}
+		length, dist = e.findMatch(data, i)
+	}
+
+	if len(e.tokens) > 0 {
+		e.send_block()
+	}
+	e.flushbits()
+}
+
+func (e *Encoder) output_c(c, p uint16) {
+	e.tokens = append(e.tokens, lzToken{c: c, p: p})
+	e.c_freq[c]++
+	if c > UCHAR_MAX {
+		e.p_freq[bitLength(p)]++
+	}
+	if len(e.tokens) >= BLOCKSIZ {
+		e.send_block()
+	}
+}
+
+func countUsed(freq []int) int {
+	n := 0
+	for _, f := range freq {
+		if f > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func bitLength(p uint16) int {
+	c := 0
+	for p != 0 {
+		p >>= 1
+		c++
+	}
+	return c
+}
+
+func (e *Encoder) count_t_freq() {
+	for i := range e.t_freq {
+		e.t_freq[i] = 0
+	}
+	n := NC
+	for n > 0 && e.c_len[n-1] == 0 {
+		n--
+	}
+	i := 0
+	for i < n {
+		k := e.c_len[i]
+		i++
+		if k == 0 {
+			count := 1
+			for i < n && e.c_len[i] == 0 {
+				i++
+				count++
+			}
+			if count <= 2 {
+				e.t_freq[0] += count
+			} else if count <= 18 {
+				e.t_freq[1]++
+			} else if count == 19 {
+				e.t_freq[0]++
+				e.t_freq[1]++
+			} else {
+				e.t_freq[2]++
+			}
+		} else {
+			e.t_freq[k+2]++
+		}
+	}
+}
+
+func (e *Encoder) write_pt_len(n, nbit, i_special int) {
+	for n > 0 && e.pt_len[n-1] == 0 {
+		n--
+	}
+	e.putbits(nbit, uint16(n))
+	i := 0
+	for i < n {
+		k := int(e.pt_len[i])
+		i++
+		if k <= 6 {
+			e.putbits(3, uint16(k))
+		} else {
+			e.putbits(k-3, uint16(1<<(k-3)-2))
+		}
+		if i == i_special {
+			for i < 6 && e.pt_len[i] == 0 {
+				i++
+			}
+			e.putbits(2, uint16((i-3)&3))
+		}
+	}
+}
+
+func (e *Encoder) write_c_len() {
+	n := NC
+	for n > 0 && e.c_len[n-1] == 0 {
+		n--
+	}
+	e.putbits(CBIT, uint16(n))
+	i := 0
+	for i < n {
+		k := int(e.c_len[i])
+		i++
+		if k == 0 {
+			count := 1
+			for i < n && e.c_len[i] == 0 {
+				i++
+				count++
+			}
+			if count <= 2 {
+				for j := 0; j < count; j++ {
+					e.putbits(int(e.pt_len[0]), e.pt_code[0])
+				}
+			} else if count <= 18 {
+				e.putbits(int(e.pt_len[1]), e.pt_code[1])
+				e.putbits(4, uint16(count-3))
+			} else if count == 19 {
+				e.putbits(int(e.pt_len[0]), e.pt_code[0])
+				e.putbits(int(e.pt_len[1]), e.pt_code[1])
+				e.putbits(4, 15)
+			} else {
+				e.putbits(int(e.pt_len[2]), e.pt_code[2])
+				e.putbits(CBIT, uint16(count-20))
+			}
+		} else {
+			e.putbits(int(e.pt_len[k+2]), e.pt_code[k+2])
+		}
+	}
+}
+
+func (e *Encoder) encode_p(p uint16) {
+	c := bitLength(p)
+	e.putbits(int(e.pt_len[c]), e.pt_code[c])
+	if c > 1 {
+		e.putbits(c-1, p&(0xffff>>(17-c)))
+	}
+}
+
+func (e *Encoder) send_block() {
+	e.putbits(16, uint16(len(e.tokens)))
+
+	// Literal/length tree, itself described by the "t" tree. libarchive
+	// rejects a tree reduced to a single code: a second symbol, never
+	// emitted, gives it two codes of one bit
+	if countUsed(e.c_freq[:]) == 1 {
+		dummy := 0
+		if e.c_freq[0] != 0 {
+			dummy = 1
+		}
+		e.c_freq[dummy] = 1
+	}
+	if root := make_tree(e.c_freq[:], e.c_len[:], e.c_code[:]); root < 0 {
+		e.count_t_freq()
+		if root := make_tree(e.t_freq[:], e.pt_len[:NT], e.pt_code[:NT]); root < 0 {
+			e.write_pt_len(NT, TBIT, 3)
+		} else {
+			e.putbits(TBIT, 0)
+			e.putbits(TBIT, uint16(root))
+		}
+		e.write_c_len()
+	} else {
+		e.putbits(TBIT, 0)
+		e.putbits(TBIT, 0)
+		e.putbits(CBIT, 0)
+		e.putbits(CBIT, uint16(root))
+	}
+
+	// Position tree
+	np, pbit := e.params.np, e.params.pbit
+	if root := make_tree(e.p_freq[:np], e.pt_len[:np], e.pt_code[:np]); root < 0 {
+		e.write_pt_len(np, pbit, -1)
+	} else {
+		e.putbits(pbit, 0)
+		e.putbits(pbit, uint16(root))
+	}
+
+	for _, t := range e.tokens {
+		e.putbits(int(e.c_len[t.c]), e.c_code[t.c])
+		if t.c > UCHAR_MAX {
+			e.encode_p(t.p)
+		}
+	}
+
+	// Reset block state
+	e.tokens = e.tokens[:0]
+	for i := range e.c_freq {
+		e.c_freq[i] = 0
+	}
+	for i := range e.p_freq {
+		e.p_freq[i] = 0
+	}
+}
+
+// make_tree computes 16-bit limited Huffman code lengths and canonical codes.
+// It returns the only used symbol when fewer than two symbols occur, -1 otherwise.
+func make_tree(freq []int, bitlen []uint8, code []uint16) int {
+	for i := range bitlen {
+		bitlen[i] = 0
+		code[i] = 0
+	}
+
+	syms := make([]int, 0, len(freq))
+	for i, f := range freq {
+		if f > 0 {
+			syms = append(syms, i)
+		}
+	}
+	if len(syms) == 0 {
+		return 0
+	}
+	if len(syms) == 1 {
+		return syms[0]
+	}
+
+	// Leaves by increasing frequency
+	sort.SliceStable(syms, func(a, b int) bool {
+		return freq[syms[a]] < freq[syms[b]]
+	})
+
+	// Two-queue Huffman construction: leaves are nodes [0,m), internal nodes follow
+	m := len(syms)
+	weight := make([]int, 2*m-1)
+	parent := make([]int, 2*m-1)
+	for i, s := range syms {
+		weight[i] = freq[s]
+	}
+	leaf, node, next := 0, m, m
+	pick := func() int {
+		if leaf < m && (node >= next || weight[leaf] <= weight[node]) {
+			leaf++
+			return leaf - 1
+		}
+		node++
+		return node - 1
+	}
+	for next < 2*m-1 {
+		a := pick()
+		b := pick()
+		weight[next] = weight[a] + weight[b]
+		parent[a] = next
+		parent[b] = next
+		next++
+	}
+
+	// Count code lengths, clamped to 16 bits
+	var len_cnt [17]int
+	depth := make([]int, 2*m-1)
+	for i := 2*m - 3; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+	}
+	for i := 0; i < m; i++ {
+		d := depth[i]
+		if d > 16 {
+			d = 16
+		}
+		len_cnt[d]++
+	}
+
+	// Restore the Kraft equality after clamping
+	cum := 0
+	for i := 16; i > 0; i-- {
+		cum += len_cnt[i] << (16 - i)
+	}
+	for cum != 1<<16 {
+		len_cnt[16]--
+		for i := 15; i > 0; i-- {
+			if len_cnt[i] != 0 {
+				len_cnt[i]--
+				len_cnt[i+1] += 2
+				break
+			}
+		}
+		cum--
+	}
+
+	// Least frequent symbols get the longest codes
+	k := 0
+	for i := 16; i > 0; i-- {
+		for c := len_cnt[i]; c > 0; c-- {
+			bitlen[syms[k]] = uint8(i)
+			k++
+		}
+	}
+
+	make_code(len_cnt[:], bitlen, code)
+	return -1
+}
+
+func make_code(len_cnt []int, bitlen []uint8, code []uint16) {
+	var start [18]uint16
+	for i := 1; i <= 16; i++ {
+		start[i+1] = (start[i] + uint16(len_cnt[i])) << 1
+	}
+	for i := range bitlen {
+		if bitlen[i] > 0 {
+			code[i] = start[bitlen[i]]
+			start[bitlen[i]]++
+		}
+	}
+}
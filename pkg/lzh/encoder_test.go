@@ -0,0 +1,81 @@
+package lzh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	random := make([]byte, 50000)
+	rand.New(rand.NewSource(1)).Read(random)
+	// Plus de BLOCKSIZ codes : plusieurs blocs Huffman, dont des blocs
+	// de correspondances toutes identiques
+	large := bytes.Repeat([]byte("YM6!LeOnArD!\x00\x01\x02\x03"), 4*BLOCKSIZ)
+	large = append(large, random[:BLOCKSIZ*2]...)
+
+	modTime := time.Date(2024, 3, 14, 15, 9, 26, 0, time.Local)
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		method string
+	}{
+		{"empty", nil, "-lh0-"},
+		{"one byte", []byte("a"), "-lh0-"},
+		{"random", random, "-lh0-"},
+		{"repetitive", bytes.Repeat([]byte("a"), 5000), "-lh5-"},
+		{"one literal then matches", bytes.Repeat([]byte("a"), 256*BLOCKSIZ+300), "-lh5-"},
+		{"large", large, "-lh5-"},
+	} {
+		archive, err := Compress("song.ym", tc.data, modTime)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		header, err := ParseHeader(archive)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if sum := headerChecksum(archive[2:header.HeaderSize]); archive[1] != sum {
+			t.Errorf("%s: header checksum 0x%02X, want 0x%02X", tc.name, archive[1], sum)
+		}
+		if header.Method != tc.method || header.Name != "song.ym" || !header.ModTime.Equal(modTime.Truncate(2*time.Second)) {
+			t.Errorf("%s: header %+v", tc.name, header)
+		}
+		if header.OriginalSize != uint32(len(tc.data)) || !header.HasCRC || header.CRC != CRC16(tc.data) {
+			t.Errorf("%s: size %d, CRC 0x%04X, want %d, 0x%04X",
+				tc.name, header.OriginalSize, header.CRC, len(tc.data), CRC16(tc.data))
+		}
+		if end := header.HeaderSize + int(header.PackedSize); end != len(archive)-1 || archive[end] != 0 {
+			t.Errorf("%s: packed size %d for a %d-byte archive", tc.name, header.PackedSize, len(archive))
+		}
+
+		out, err := Decompress(archive)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !bytes.Equal(out, tc.data) {
+			t.Errorf("%s: decompressed data differs", tc.name)
+		}
+	}
+
+	// Compress les stocke, mais les flux -lh5- d'un seul littéral restent
+	// décodables
+	for _, data := range []string{"a", "aa", "aaa", "ab"} {
+		h := &Header{Method: "-lh5-", OriginalSize: uint32(len(data)), CRC: CRC16([]byte(data)), HasCRC: true}
+		if out, err := h.Decode(EncodeLH5([]byte(data))); err != nil || string(out) != data {
+			t.Errorf("EncodeLH5(%q) decodes to %q, %v", data, out, err)
+		}
+	}
+
+	// Un CRC faux est détecté à la décompression
+	archive, _ := Compress("song.ym", large, modTime)
+	binary.LittleEndian.PutUint16(archive[22+len("song.ym"):], CRC16(large)^1)
+	archive[1] = headerChecksum(archive[2 : 24+len("song.ym")])
+	if _, err := Decompress(archive); !errors.Is(err, ErrCRC) {
+		t.Error("wrong CRC16 not detected")
+	}
+}
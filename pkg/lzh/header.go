@@ -0,0 +1,251 @@
+package lzh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Errors returned while reading an LHA archive
+var (
+	ErrHeaderNotFound    = errors.New("LZH header not found")
+	ErrTruncated         = errors.New("LZH data truncated")
+	ErrHeaderChecksum    = errors.New("LZH header checksum mismatch")
+	ErrCorrupt           = errors.New("corrupt LZH data")
+	ErrCRC               = errors.New("LZH CRC mismatch")
+	ErrUnsupportedMethod = errors.New("unsupported LZH method")
+	ErrUnsupportedLevel  = errors.New("unsupported LZH header level")
+	ErrTooLarge          = errors.New("LZH member too large")
+)
+
+// CRCError reports a member whose decoded data does not match the header CRC
+type CRCError struct {
+	Name     string
+	Expected uint16
+	Actual   uint16
+}
+
+func (e *CRCError) Error() string {
+	return fmt.Sprintf("%s: %q: expected 0x%04X, got 0x%04X", ErrCRC, e.Name, e.Expected, e.Actual)
+}
+
+// Is lets errors.Is(err, ErrCRC) match a *CRCError
+func (e *CRCError) Is(target error) bool {
+	return target == ErrCRC
+}
+
+// Extended header types (level 1 and 2)
+const (
+	extCommon    = 0x00 // Header CRC
+	extFilename  = 0x01
+	extDirectory = 0x02 // Path elements separated by 0xFF
+	extAttribute = 0x40 // MS-DOS attribute
+	extUnixTime  = 0x54
+)
+
+// Header describes one member of an LHA archive
+type Header struct {
+	Level        int
+	Method       string // "-lh5-", "-lh0-", ...
+	PackedSize   uint32 // Size of the compressed data following the header
+	OriginalSize uint32
+	ModTime      time.Time
+	Attribute    uint8
+	Name         string // Path with '/' separators
+	CRC          uint16 // CRC16 of the original data
+	HasCRC       bool
+	OS           byte // Level 1/2 only, 0 if absent
+	HeaderSize   int  // Total header size, extended headers included
+}
+
+// ParseHeader decodes the LHA member header found at the start of data.
+// Levels 0, 1 and 2 are supported.
+func ParseHeader(data []byte) (*Header, error) {
+	if len(data) < 22 {
+		return nil, ErrTruncated
+	}
+	if data[2] != '-' || data[3] != 'l' || data[6] != '-' {
+		return nil, ErrHeaderNotFound
+	}
+
+	h := &Header{
+		Level:        int(data[20]),
+		Method:       string(data[2:7]),
+		PackedSize:   binary.LittleEndian.Uint32(data[7:11]),
+		OriginalSize: binary.LittleEndian.Uint32(data[11:15]),
+		Attribute:    data[19],
+	}
+
+	var err error
+	switch h.Level {
+	case 0, 1:
+		err = h.parseLevel01(data)
+	case 2:
+		err = h.parseLevel2(data)
+	default:
+		err = fmt.Errorf("%w: %d", ErrUnsupportedLevel, h.Level)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Header) parseLevel01(data []byte) error {
+	baseSize := int(data[0]) + 2
+	if len(data) < baseSize {
+		return ErrTruncated
+	}
+	if headerChecksum(data[2:baseSize]) != data[1] {
+		return ErrHeaderChecksum
+	}
+
+	nameLen := int(data[21])
+	if 22+nameLen > baseSize {
+		return fmt.Errorf("%w: file name overflows header", ErrCorrupt)
+	}
+	h.Name = dosPath(data[22 : 22+nameLen])
+	h.ModTime = fromDosTime(binary.LittleEndian.Uint32(data[15:19]))
+	h.HeaderSize = baseSize
+
+	pos := 22 + nameLen
+	if pos+2 <= baseSize {
+		h.CRC = binary.LittleEndian.Uint16(data[pos:])
+		h.HasCRC = true
+	}
+	if h.Level == 0 {
+		return nil
+	}
+
+	// Level 1: OS id and size of the first extended header close the base header
+	if pos+5 > baseSize {
+		return fmt.Errorf("%w: level 1 header too short", ErrCorrupt)
+	}
+	h.OS = data[pos+2]
+	next := int(binary.LittleEndian.Uint16(data[baseSize-2:]))
+	extSize, err := h.parseExtHeaders(data, baseSize, next)
+	if err != nil {
+		return err
+	}
+
+	// The packed size field also counts the extended headers
+	if uint32(extSize) > h.PackedSize {
+		return fmt.Errorf("%w: extended headers larger than packed size", ErrCorrupt)
+	}
+	h.PackedSize -= uint32(extSize)
+	h.HeaderSize += extSize
+	return nil
+}
+
+func (h *Header) parseLevel2(data []byte) error {
+	h.HeaderSize = int(binary.LittleEndian.Uint16(data[0:2]))
+	if h.HeaderSize < 26 {
+		return fmt.Errorf("%w: level 2 header too short", ErrCorrupt)
+	}
+	if len(data) < h.HeaderSize {
+		return ErrTruncated
+	}
+
+	h.ModTime = time.Unix(int64(binary.LittleEndian.Uint32(data[15:19])), 0)
+	h.CRC = binary.LittleEndian.Uint16(data[21:23])
+	h.HasCRC = true
+	h.OS = data[23]
+
+	next := int(binary.LittleEndian.Uint16(data[24:26]))
+	extSize, err := h.parseExtHeaders(data[:h.HeaderSize], 26, next)
+	if err != nil {
+		return err
+	}
+	if 26+extSize > h.HeaderSize {
+		return fmt.Errorf("%w: extended headers overflow header", ErrCorrupt)
+	}
+	return nil
+}
+
+// parseExtHeaders walks the extended header chain starting at pos and
+// returns its total size. Each entry is: type, payload, size of the next entry.
+func (h *Header) parseExtHeaders(data []byte, pos, next int) (int, error) {
+	var dir string
+	total := 0
+	crcPos := -1
+
+	for next != 0 {
+		if next < 3 {
+			return 0, fmt.Errorf("%w: bad extended header size %d", ErrCorrupt, next)
+		}
+		if pos+next > len(data) {
+			return 0, ErrTruncated
+		}
+		ext := data[pos : pos+next]
+		payload := ext[1 : next-2]
+
+		switch ext[0] {
+		case extCommon:
+			if len(payload) >= 2 {
+				crcPos = pos + 1
+			}
+		case extFilename:
+			h.Name = string(payload)
+		case extDirectory:
+			dir = dosPath(payload)
+		case extAttribute:
+			if len(payload) >= 1 {
+				h.Attribute = payload[0]
+			}
+		case extUnixTime:
+			if len(payload) >= 4 {
+				h.ModTime = time.Unix(int64(binary.LittleEndian.Uint32(payload)), 0)
+			}
+		}
+
+		total += next
+		pos += next
+		next = int(binary.LittleEndian.Uint16(ext[next-2:]))
+	}
+
+	// Le CRC d'en-tête est calculé avec son propre champ à zéro
+	if crcPos >= 0 && h.Level == 2 {
+		expected := binary.LittleEndian.Uint16(data[crcPos:])
+		crc := updateCRC16(0, data[:crcPos])
+		crc = updateCRC16(crc, []byte{0, 0})
+		crc = updateCRC16(crc, data[crcPos+2:h.HeaderSize])
+		if crc != expected {
+			return 0, ErrHeaderChecksum
+		}
+	}
+
+	if dir != "" {
+		if !strings.HasSuffix(dir, "/") {
+			dir += "/"
+		}
+		h.Name = dir + h.Name
+	}
+	return total, nil
+}
+
+// IsDir reports whether the member is a directory entry
+func (h *Header) IsDir() bool {
+	return h.Method == "-lhd-"
+}
+
+// dosPath converts the '\' and 0xFF path separators used by LHA to '/'
+func dosPath(b []byte) string {
+	p := make([]byte, len(b))
+	for i, c := range b {
+		if c == '\\' || c == 0xFF {
+			c = '/'
+		}
+		p[i] = c
+	}
+	return string(p)
+}
+
+func fromDosTime(t uint32) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Date(int(t>>25)+1980, time.Month(t>>21&0x0f), int(t>>16&0x1f),
+		int(t>>11&0x1f), int(t>>5&0x3f), int(t&0x1f)*2, 0, time.Local)
+}
@@ -0,0 +1,161 @@
+package lzh
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// member builds an LHA member with a level 0, 1 or 2 header. The directory
+// goes in the name at level 0, in an extended header at levels 1 and 2.
+func member(level int, method, dir, name string, packed, data []byte, modTime time.Time) []byte {
+	h := make([]byte, 22, 64)
+	copy(h[2:7], method)
+	binary.LittleEndian.PutUint32(h[7:11], uint32(len(packed)))
+	binary.LittleEndian.PutUint32(h[11:15], uint32(len(data)))
+	h[19] = 0x20
+	h[20] = byte(level)
+
+	ext := func(kind byte, payload string) []byte {
+		e := append([]byte{kind}, payload...)
+		return binary.LittleEndian.AppendUint16(e, 0)
+	}
+	// Chaque en-tête étendu se termine par la taille du suivant
+	chain := func(exts ...[]byte) []byte {
+		var out []byte
+		for i, e := range exts {
+			if i+1 < len(exts) {
+				binary.LittleEndian.PutUint16(e[len(e)-2:], uint16(len(exts[i+1])))
+			}
+			out = append(out, e...)
+		}
+		return out
+	}
+
+	extDir := ""
+	if dir != "" {
+		extDir = strings.TrimSuffix(dir, "\\") + "\xff"
+	}
+	switch level {
+	case 0:
+		binary.LittleEndian.PutUint32(h[15:19], dosTime(modTime))
+		h[21] = byte(len(dir + name))
+		h = append(h, dir+name...)
+		h = binary.LittleEndian.AppendUint16(h, CRC16(data))
+		h[0] = byte(len(h) - 2)
+		h[1] = headerChecksum(h[2:])
+
+	case 1:
+		binary.LittleEndian.PutUint32(h[15:19], dosTime(modTime))
+		h[21] = byte(len(name))
+		h = append(h, name...)
+		h = binary.LittleEndian.AppendUint16(h, CRC16(data))
+		dirExt := ext(extDirectory, extDir)
+		exts := chain(dirExt, ext(extAttribute, "\x21"))
+		h = append(h, 'U')
+		h = binary.LittleEndian.AppendUint16(h, uint16(len(dirExt)))
+		// La taille compressée compte les en-têtes étendus
+		binary.LittleEndian.PutUint32(h[7:11], uint32(len(packed)+len(exts)))
+		h[0] = byte(len(h) - 2)
+		h[1] = headerChecksum(h[2:])
+		h = append(h, exts...)
+
+	case 2:
+		binary.LittleEndian.PutUint32(h[15:19], uint32(modTime.Unix()))
+		h = binary.LittleEndian.AppendUint16(h[:21], CRC16(data))
+		h = append(h, 'U')
+		exts := chain(ext(extCommon, "\x00\x00"), ext(extFilename, name), ext(extDirectory, extDir))
+		h = binary.LittleEndian.AppendUint16(h, 5)
+		h = append(h, exts...)
+		binary.LittleEndian.PutUint16(h[0:2], uint16(len(h)))
+		binary.LittleEndian.PutUint16(h[27:29], CRC16(h)) // CRC de l'en-tête, champ à zéro
+	}
+	return append(h, packed...)
+}
+
+func TestParseHeader(t *testing.T) {
+	modTime := time.Date(1992, 6, 1, 12, 30, 10, 0, time.Local)
+	rnd := rand.New(rand.NewSource(1))
+
+	for _, method := range []string{"-lh4-", "-lh5-", "-lh6-", "-lh7-"} {
+		// Deux copies à 3/4 de la taille du dictionnaire : la seconde n'est
+		// compressée que si le dictionnaire de la méthode est respecté
+		params := lhMethods[method]
+		half := make([]byte, 3<<params.dicbit/4)
+		rnd.Read(half)
+		data := append(half, half...)
+		packed := encodeLH(data, params)
+		if len(packed) > len(half)+len(half)/4 {
+			t.Errorf("%s: %d bytes packed to %d, the repeat was not found", method, len(data), len(packed))
+		}
+
+		for level := 0; level <= 2; level++ {
+			archive := member(level, method, "songs\\", "tune.ym", packed, data, modTime)
+			h, err := ParseHeader(archive)
+			if err != nil {
+				t.Fatalf("%s level %d: %v", method, level, err)
+			}
+			if h.Level != level || h.Method != method || h.Name != "songs/tune.ym" || !h.ModTime.Equal(modTime) ||
+				h.PackedSize != uint32(len(packed)) || h.OriginalSize != uint32(len(data)) ||
+				!h.HasCRC || h.CRC != CRC16(data) || h.HeaderSize != len(archive)-len(packed) {
+				t.Errorf("%s level %d: %+v", method, level, h)
+			}
+			wantOS, wantAttr := byte('U'), byte(0x20)
+			if level == 0 {
+				wantOS = 0
+			} else if level == 1 {
+				wantAttr = 0x21 // En-tête étendu
+			}
+			if h.OS != wantOS || h.Attribute != wantAttr {
+				t.Errorf("%s level %d: OS %q, attribute 0x%02X", method, level, h.OS, h.Attribute)
+			}
+
+			out, err := Decompress(archive)
+			if err != nil || string(out) != string(data) {
+				t.Errorf("%s level %d: decompression failed: %v", method, level, err)
+			}
+		}
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	data := []byte("YM6!LeOnArD!")
+	for level := 0; level <= 2; level++ {
+		archive := member(level, "-lh0-", "", "tune.ym", data, data, time.Time{})
+
+		// Somme de contrôle (niveaux 0 et 1) ou CRC d'en-tête (niveau 2)
+		bad := append([]byte(nil), archive...)
+		if level == 2 {
+			bad[27] ^= 1
+		} else {
+			bad[1]++
+		}
+		if _, err := ParseHeader(bad); !errors.Is(err, ErrHeaderChecksum) {
+			t.Errorf("level %d: bad header check: %v, want ErrHeaderChecksum", level, err)
+		}
+
+		// CRC16 des données
+		bad = append([]byte(nil), archive...)
+		bad[len(bad)-1] ^= 1
+		if _, err := Decompress(bad); !errors.Is(err, ErrCRC) {
+			t.Errorf("level %d: bad data CRC: %v, want ErrCRC", level, err)
+		}
+
+		if _, err := ParseHeader(archive[:len(archive)-len(data)-1]); !errors.Is(err, ErrTruncated) {
+			t.Errorf("level %d: truncated header: %v, want ErrTruncated", level, err)
+		}
+	}
+
+	archive := member(0, "-lh0-", "", "tune.ym", data, data, time.Time{})
+	archive[20] = 3
+	if _, err := ParseHeader(archive); !errors.Is(err, ErrUnsupportedLevel) {
+		t.Errorf("level 3: %v, want ErrUnsupportedLevel", err)
+	}
+	archive = member(2, "-lh9-", "", "tune.ym", data, data, time.Time{})
+	if _, err := Decompress(archive); !errors.Is(err, ErrUnsupportedMethod) {
+		t.Errorf("-lh9-: %v, want ErrUnsupportedMethod", err)
+	}
+}
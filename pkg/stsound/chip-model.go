@@ -0,0 +1,94 @@
+package stsound
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ChipModel selects the sound chip variant: volume curve and envelope
+// resolution, on both cores. The noise generator does not depend on it: the
+// two chips have the same 17-bit LFSR (bit 0 xor bit 3, checked on real
+// chips), which the accurate core emulates; the fast core keeps the
+// ST-Sound generator for both.
+type ChipModel int
+
+const (
+	// ChipYM2149 is the Yamaha chip of the Atari ST: 32-step envelope, the
+	// fixed volumes use every other step
+	ChipYM2149 ChipModel = iota
+	// ChipAY8910 is the General Instrument chip of the Amstrad CPC and
+	// ZX Spectrum: 16 volume levels, envelope included
+	ChipAY8910
+)
+
+func (m ChipModel) String() string {
+	switch m {
+	case ChipYM2149:
+		return "YM2149"
+	case ChipAY8910:
+		return "AY-3-8910"
+	}
+	return "unknown"
+}
+
+// ParseChipModel accepts "ym", "ym2149", "ay", "ay8910" or "ay-3-8910"
+func ParseChipModel(s string) (ChipModel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "ym", "ym2149":
+		return ChipYM2149, nil
+	case "ay", "ay8910", "ay-3-8910":
+		return ChipAY8910, nil
+	}
+	return ChipYM2149, fmt.Errorf("unknown chip model %q: expected ym or ay", s)
+}
+
+// Courbe du DAC de l'AY-3-8910, mesurée sur un vrai chip (normalisée à 1)
+var ayDacTable = [16]float64{
+	0.0, 0.00999465934234, 0.0144502937362, 0.0210574502174,
+	0.0307011520562, 0.0455481803616, 0.0644998855573, 0.107362478065,
+	0.126588845655, 0.20498970016, 0.292210269322, 0.372838941024,
+	0.492530708782, 0.635324635691, 0.805584802014, 1.0,
+}
+
+// Courbe du DAC 32 niveaux du YM2149, mesurée sur un vrai chip (table
+// d'Ayumi, normalisée à 1). Les volumes fixes sont les niveaux impairs.
+var ymDacTable = [32]float64{
+	0.0, 0.0, 0.00465400167849, 0.00772106507973,
+	0.0109559777218, 0.0139620050355, 0.0169985503929, 0.0200198367285,
+	0.024368657969, 0.029694056611, 0.0350652323186, 0.0403906309606,
+	0.0485389486534, 0.0583352407111, 0.0680552376593, 0.0777752346075,
+	0.0925154497597, 0.111085679408, 0.129747463188, 0.148485542077,
+	0.17666895552, 0.211551079576, 0.246387426566, 0.281101701381,
+	0.333730067903, 0.400427252613, 0.467383840696, 0.53443198291,
+	0.635172045472, 0.75800717174, 0.879926756695, 1.0,
+}
+
+// SetChipModel switches the chip variant, registers are kept
+func (ym *CYm2149Ex) SetChipModel(model ChipModel) {
+	ym.chipModel = model
+	ym.updateVolumeTable()
+}
+
+// GetChipModel returns the chip variant being emulated
+func (ym *CYm2149Ex) GetChipModel() ChipModel {
+	return ym.chipModel
+}
+
+// updateVolumeTable builds the envelope levels of the chip model, then
+// reloads the fixed volumes
+func (ym *CYm2149Ex) updateVolumeTable() {
+	full := float64(ymVolumeTable[15])
+	for i := range ym.volumeTable {
+		if ym.chipModel == ChipAY8910 {
+			// 16 niveaux : chaque pas de l'AY dure deux pas d'enveloppe
+			ym.volumeTable[i] = YmInt(math.Round(ayDacTable[i>>1] * full))
+		} else {
+			ym.volumeTable[i] = YmInt(math.Round(ymDacTable[i] * full))
+		}
+	}
+
+	for voice := YmInt(0); voice < 3; voice++ {
+		ym.WriteRegister(8+voice, YmInt(ym.registers[8+voice]))
+	}
+}
@@ -0,0 +1,74 @@
+package stsound
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// Le rendu par défaut (YM2149, core rapide) : enveloppe de 32 pas et volumes
+// fixes sur la table mesurée du YM2149
+func TestDefaultRender(t *testing.T) {
+	const golden uint64 = 0x072118be314dadec
+	if got := renderHash(t, chipSong(t), func(*CYmMusic) {}); got != golden {
+		t.Errorf("default render hash %#x, want %#x", got, golden)
+	}
+}
+
+func TestChipModelAY(t *testing.T) {
+	const golden uint64 = 0x60b8c2d0c405e13a
+	data := chipSong(t)
+	ay := renderHash(t, data, func(ym *CYmMusic) { ym.SetChipModel(ChipAY8910) })
+	if ay != golden {
+		t.Errorf("AY-3-8910 render hash %#x, want %#x", ay, golden)
+	}
+	if back := renderHash(t, data, func(ym *CYmMusic) {
+		ym.SetChipModel(ChipAY8910)
+		ym.SetChipModel(ChipYM2149)
+	}); back != renderHash(t, data, func(*CYmMusic) {}) {
+		t.Error("switching back to the YM2149 does not restore its output")
+	}
+
+	// Volumes fixes sur la courbe de l'AY, enveloppe de 16 niveaux sur les
+	// deux cores
+	for _, core := range []YmCore{CoreFast, CoreAccurate} {
+		chip := NewYm2149ExWithModel(ChipAY8910, ATARI_CLOCK, 1, 44100)
+		chip.SetCore(core)
+		full := float64(chip.fixedVolume(15))
+		for v := YmInt(0); v < 16; v++ {
+			if got := float64(chip.fixedVolume(v)) / full; math.Abs(got-ayDacTable[v]) > 1e-3 {
+				t.Errorf("%s: volume %d at %.4f, want %.4f", core, v, got, ayDacTable[v])
+			}
+		}
+		levels := slices.Compact(slices.Clone(chip.volumeTable[:]))
+		if len(levels) != 16 {
+			t.Errorf("%s: %d envelope levels, want 16", core, len(levels))
+		}
+	}
+}
+
+// On the fast core, the YM2149 envelope goes through the 32 measured steps,
+// the AY-3-8910 one through 16. Le core précis lit les mêmes tables, mais son
+// resampler lisse les marches.
+func TestEnvelopeSteps(t *testing.T) {
+	for chip, want := range map[ChipModel]int{
+		// Les deux premiers niveaux du YM2149 sont à 0
+		ChipYM2149: 31,
+		ChipAY8910: 16,
+	} {
+		ym := NewYm2149ExWithModel(chip, ATARI_CLOCK, 1, 44100)
+		ym.SetFilterChain(nil)
+		// Voix A sur l'enveloppe seule, montée de 32 pas en 0.26s puis maintien
+		ym.WriteRegister(7, 0x3f)
+		ym.WriteRegister(8, 0x10)
+		ym.WriteRegister(11, 0x40)
+		ym.WriteRegister(13, 13)
+		buffer := make([]YmSample, 44100/2)
+		ym.Update(buffer, YmInt(len(buffer)))
+
+		slices.Sort(buffer)
+		if levels := len(slices.Compact(buffer)); levels != want {
+			t.Errorf("%s: %d envelope levels, want %d", chip, levels, want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package stsound
+
+import "errors"
+
+// Errors returned by the load functions, wrapped with details.
+// Test them with errors.Is.
+var (
+	ErrTruncated         = errors.New("truncated YM data")
+	ErrBadSignature      = errors.New("bad YM signature")
+	ErrUnsupportedFormat = errors.New("unsupported YM format")
+	ErrInvalidHeader     = errors.New("invalid YM header")
+	ErrDepack            = errors.New("LZH decompression failed")
+
+	// Returned by Restore
+	ErrBadSnapshot      = errors.New("invalid snapshot")
+	ErrSnapshotMismatch = errors.New("snapshot does not match the loaded song")
+
+	// Returned by ReadDump
+	ErrBadDump = errors.New("invalid register dump")
+)
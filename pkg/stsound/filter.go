@@ -0,0 +1,236 @@
+package stsound
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Filter is a stage of the output filter chain
+type Filter interface {
+	Process(in YmInt) YmInt
+	Reset()
+}
+
+// FilterStage describes a stage of the chain. New is called once per output
+// (mono or left, right, each multitrack voice) so every output keeps its own
+// state. Name identifies the stage and its parameters, in ParseFilterChain
+// syntax: a stage whose name is unchanged keeps its state when the chain is
+// replaced.
+type FilterStage struct {
+	Name string
+	New  func(sampleRate int) Filter
+}
+
+func (s FilterStage) String() string {
+	return s.Name
+}
+
+// FilterChain runs the samples through an ordered list of filters
+type FilterChain []Filter
+
+// NewFilterChain creates the filters of stages for one output
+func NewFilterChain(stages []FilterStage, sampleRate int) FilterChain {
+	return rebuildFilterChain(nil, nil, stages, sampleRate)
+}
+
+// rebuildFilterChain creates a chain for stages, reusing the filters of
+// chain (built from oldStages) that are unchanged at the same position
+func rebuildFilterChain(chain FilterChain, oldStages, stages []FilterStage, sampleRate int) FilterChain {
+	out := make(FilterChain, len(stages))
+	for i, stage := range stages {
+		if i < len(chain) && i < len(oldStages) && oldStages[i].Name == stage.Name {
+			out[i] = chain[i]
+		} else {
+			out[i] = stage.New(sampleRate)
+		}
+	}
+	return out
+}
+
+func (c FilterChain) Process(in YmInt) YmInt {
+	for _, f := range c {
+		in = f.Process(in)
+	}
+	return in
+}
+
+func (c FilterChain) Reset() {
+	for _, f := range c {
+		f.Reset()
+	}
+}
+
+// DefaultFilterStages returns the original ST-Sound chain: DC blocker,
+// followed by the 3-tap low-pass when lowPass is set
+func DefaultFilterStages(lowPass bool) []FilterStage {
+	if lowPass {
+		return []FilterStage{DCBlockerStage(), ThreeTapStage()}
+	}
+	return []FilterStage{DCBlockerStage()}
+}
+
+// DCBlockerStage removes the DC offset with a 512-sample moving average
+func DCBlockerStage() FilterStage {
+	return FilterStage{"dc", func(int) Filter { return NewDcAdjuster() }}
+}
+
+// Process makes DcAdjuster a Filter
+func (d *DcAdjuster) Process(in YmInt) YmInt {
+	d.AddSample(in)
+	return in - d.GetDcLevel()
+}
+
+// ThreeTapStage is the original ST-Sound low-pass: (x[n-2] + 2x[n-1] + x[n]) / 4
+func ThreeTapStage() FilterStage {
+	return FilterStage{"3tap", func(int) Filter { return &threeTapFilter{} }}
+}
+
+type threeTapFilter struct {
+	state [2]int
+}
+
+func (f *threeTapFilter) Process(in YmInt) YmInt {
+	return YmInt(lowPass(&f.state, int(in)))
+}
+
+func (f *threeTapFilter) Reset() {
+	f.state = [2]int{}
+}
+
+// LowPassStage is a 2nd order low-pass (q = 0.707 for Butterworth)
+func LowPassStage(cutoff, q float64) FilterStage {
+	return FilterStage{fmt.Sprintf("lowpass:%g:%g", cutoff, q), func(sampleRate int) Filter {
+		return NewBiquadLowPass(sampleRate, cutoff, q)
+	}}
+}
+
+// HighPassStage is a 2nd order high-pass (q = 0.707 for Butterworth)
+func HighPassStage(cutoff, q float64) FilterStage {
+	return FilterStage{fmt.Sprintf("highpass:%g:%g", cutoff, q), func(sampleRate int) Filter {
+		return NewBiquadHighPass(sampleRate, cutoff, q)
+	}}
+}
+
+// Biquad is a 2nd order IIR filter (coefficients from the RBJ Audio EQ Cookbook)
+type Biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// NewBiquadLowPass creates a low-pass filter
+func NewBiquadLowPass(sampleRate int, cutoff, q float64) *Biquad {
+	cos, alpha := biquadParams(sampleRate, cutoff, q)
+	return newBiquad((1-cos)/2, 1-cos, (1-cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
+
+// NewBiquadHighPass creates a high-pass filter
+func NewBiquadHighPass(sampleRate int, cutoff, q float64) *Biquad {
+	cos, alpha := biquadParams(sampleRate, cutoff, q)
+	return newBiquad((1+cos)/2, -(1 + cos), (1+cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
+
+func biquadParams(sampleRate int, cutoff, q float64) (float64, float64) {
+	// La coupure reste sous Nyquist
+	cutoff = math.Min(cutoff, 0.49*float64(sampleRate))
+	w := 2 * math.Pi * cutoff / float64(sampleRate)
+	return math.Cos(w), math.Sin(w) / (2 * q)
+}
+
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) *Biquad {
+	return &Biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1 / a0, a2: a2 / a0}
+}
+
+func (f *Biquad) Process(in YmInt) YmInt {
+	x := float64(in)
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return YmInt(math.Round(y))
+}
+
+func (f *Biquad) Reset() {
+	f.x1, f.x2, f.y1, f.y2 = 0, 0, 0, 0
+}
+
+// Atari ST output stage, simplified: a first order RC low-pass and the
+// coupling capacitor of the monitor output
+const (
+	stOutputLowPass  = 7200.0 // Hz
+	stOutputHighPass = 3.5    // Hz
+)
+
+// AtariSTStage emulates the RC network at the Atari ST audio output
+func AtariSTStage() FilterStage {
+	return FilterStage{"st", func(sampleRate int) Filter {
+		rate := float64(sampleRate)
+		return &rcFilter{
+			lowPass:  1 - math.Exp(-2*math.Pi*math.Min(stOutputLowPass, 0.49*rate)/rate),
+			highPass: 1 / (1 + 2*math.Pi*stOutputHighPass/rate),
+		}
+	}}
+}
+
+type rcFilter struct {
+	lowPass, highPass float64 // Coefficients of the two RC cells
+	low               float64 // Low-pass output
+	high, lastLow     float64 // High-pass output and previous input
+}
+
+func (f *rcFilter) Process(in YmInt) YmInt {
+	f.low += f.lowPass * (float64(in) - f.low)
+	f.high = f.highPass * (f.high + f.low - f.lastLow)
+	f.lastLow = f.low
+	return YmInt(math.Round(f.high))
+}
+
+func (f *rcFilter) Reset() {
+	f.low, f.high, f.lastLow = 0, 0, 0
+}
+
+// ParseFilterChain reads a comma-separated list of stages: dc, 3tap, st,
+// lowpass[:cutoff[:q]] and highpass[:cutoff[:q]], such as "dc,lowpass:8000".
+// "none" gives an empty chain.
+func ParseFilterChain(s string) ([]FilterStage, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	stages := []FilterStage{}
+	if s == "none" {
+		return stages, nil
+	}
+
+	for _, field := range strings.Split(s, ",") {
+		args := strings.Split(strings.TrimSpace(field), ":")
+		switch args[0] {
+		case "dc":
+			stages = append(stages, DCBlockerStage())
+		case "3tap":
+			stages = append(stages, ThreeTapStage())
+		case "st":
+			stages = append(stages, AtariSTStage())
+		case "lowpass", "highpass":
+			params := []float64{8000, 0.707}
+			if args[0] == "highpass" {
+				params[0] = 20
+			}
+			if len(args) > 3 {
+				return nil, fmt.Errorf("invalid filter %q: expected %s[:cutoff[:q]]", field, args[0])
+			}
+			for i, arg := range args[1:] {
+				v, err := strconv.ParseFloat(arg, 64)
+				if err != nil || v <= 0 {
+					return nil, fmt.Errorf("invalid filter %q: %q is not a positive number", field, arg)
+				}
+				params[i] = v
+			}
+			if args[0] == "lowpass" {
+				stages = append(stages, LowPassStage(params[0], params[1]))
+			} else {
+				stages = append(stages, HighPassStage(params[0], params[1]))
+			}
+		default:
+			return nil, fmt.Errorf("unknown filter %q: expected dc, 3tap, st, lowpass or highpass", field)
+		}
+	}
+	return stages, nil
+}
@@ -0,0 +1,97 @@
+package stsound
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseFilterChain(t *testing.T) {
+	for s, want := range map[string][]string{
+		"dc,3tap,st":                {"dc", "3tap", "st"},
+		" DC , Lowpass ":            {"dc", "lowpass:8000:0.707"},
+		"lowpass:5000,highpass":     {"lowpass:5000:0.707", "highpass:20:0.707"},
+		"highpass:30:1,lowpass:1e4": {"highpass:30:1", "lowpass:10000:0.707"},
+		"none":                      {},
+		" None ":                    {},
+	} {
+		stages, err := ParseFilterChain(s)
+		if err != nil {
+			t.Errorf("ParseFilterChain(%q): %v", s, err)
+			continue
+		}
+		if stages == nil || !slices.Equal(stageNames(stages), want) {
+			t.Errorf("ParseFilterChain(%q) = %v, want %v", s, stageNames(stages), want)
+		}
+	}
+
+	for _, bad := range []string{
+		"", "dc,", "dc,,3tap", "echo", "none,dc",
+		"lowpass:0", "lowpass:x", "lowpass:8000:-1", "highpass:20:0.7:1", "lowpass:",
+	} {
+		if stages, err := ParseFilterChain(bad); err == nil {
+			t.Errorf("ParseFilterChain(%q) = %v, want an error", bad, stageNames(stages))
+		}
+	}
+}
+
+// A stage keeps its filters, and their state, when the new chain has the
+// same stage at the same position; the other ones start from scratch
+func TestRebuildFilterChain(t *testing.T) {
+	parse := func(s string) []FilterStage {
+		stages, err := ParseFilterChain(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stages
+	}
+	const rate = 44100
+	old := parse("dc,lowpass:4000")
+	chain := NewFilterChain(old, rate)
+	for i := 0; i < 1000; i++ {
+		chain.Process(YmInt(i%100) * 50)
+	}
+
+	stages := parse("dc,lowpass:4000,st")
+	next := rebuildFilterChain(chain, old, stages, rate)
+	if len(next) != 3 || next[0] != chain[0] || next[1] != chain[1] {
+		t.Fatal("the unchanged stages are recreated")
+	}
+	if *next[2].(*rcFilter) != *stages[2].New(rate).(*rcFilter) {
+		t.Error("the new stage does not start from scratch")
+	}
+
+	// Les états continuent : même sortie que l'ancienne chaîne suivie d'un filtre neuf
+	ref := append(FilterChain{}, chain...)
+	ref[0], ref[1] = copyFilter(chain[0]), copyFilter(chain[1])
+	ref = append(ref, stages[2].New(rate))
+	for i := 0; i < 100; i++ {
+		if got, want := next.Process(YmInt(i)*300), ref.Process(YmInt(i)*300); got != want {
+			t.Fatalf("sample %d: %d, want %d", i, got, want)
+		}
+	}
+
+	// Seul l'étage modifié est recréé
+	st := next[2]
+	next = rebuildFilterChain(next, stages, parse("dc,lowpass:5000,st"), rate)
+	if next[1] == chain[1] || *next[1].(*Biquad) != *NewBiquadLowPass(rate, 5000, 0.707) {
+		t.Error("changed stage: filter not recreated")
+	}
+	if next[0] != chain[0] || next[2] != st {
+		t.Error("changed stage: the other stages are recreated")
+	}
+
+	// Le chip applique la même règle à toutes ses sorties
+	ym := NewYm2149Ex(ATARI_CLOCK, 1, rate)
+	mono, right, track := ym.filters[0], ym.filtersR[0], ym.trackFilters[2][0]
+	ym.SetFilterChain(parse("dc,highpass"))
+	if ym.filters[0] != mono || ym.filtersR[0] != right || ym.trackFilters[2][0] != track {
+		t.Error("SetFilterChain recreates the dc stage")
+	}
+	if !slices.Equal(stageNames(ym.GetFilterChain()), []string{"dc", "highpass:20:0.707"}) {
+		t.Errorf("GetFilterChain = %v", stageNames(ym.GetFilterChain()))
+	}
+	ym.SetFilterChain(nil)
+	if len(ym.filters) != 0 || len(ym.filtersR) != 0 || len(ym.trackFilters[0]) != 0 {
+		t.Error("SetFilterChain(nil) leaves filters")
+	}
+}
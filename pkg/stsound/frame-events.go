@@ -0,0 +1,122 @@
+package stsound
+
+import "slices"
+
+// EffectType is the kind of an Atari ST special effect
+type EffectType int
+
+const (
+	EffectSID        EffectType = iota // Square volume modulation by a timer
+	EffectSinusSID                     // Volume swept through a sine table (YM6)
+	EffectDigiDrum                     // Sample played through the voice volume
+	EffectSyncBuzzer                   // Envelope restarted by a timer (YM6)
+)
+
+func (e EffectType) String() string {
+	switch e {
+	case EffectSID:
+		return "sid"
+	case EffectSinusSID:
+		return "sinus-sid"
+	case EffectDigiDrum:
+		return "digidrum"
+	case EffectSyncBuzzer:
+		return "sync-buzzer"
+	}
+	return "unknown"
+}
+
+// Effect is a special effect playing on a voice
+type Effect struct {
+	Type  EffectType
+	Voice int // 0 to 2 for A to C
+	Freq  int // Timer frequency in Hz, the sample rate for a digidrum
+}
+
+// FrameEvent describes a frame of a YM2 to YM6 song when the player applies it
+type FrameEvent struct {
+	Frame int // Index of the frame in the song, loops go back to the loop frame
+
+	// r0-r13 as held by the chip once the frame is written: effect bits
+	// are masked out, and an r13 of 0xff in the file leaves the envelope
+	// shape unchanged. r14 and r15 as stored in the frame: effect timers
+	// on YM5/YM6, 0 before
+	Registers [16]byte
+
+	// Effects started by the frame, and the digidrums still playing
+	Effects []Effect
+
+	// Position of the first sample of the frame in the buffer passed to the
+	// Update or Compute call being rendered, in samples per channel
+	Offset int
+}
+
+type frameSubscriber struct {
+	id int
+	fn func(FrameEvent)
+}
+
+// SubscribeFrames calls fn for each frame of a YM2 to YM6 song, from the
+// Update call that renders it, before its first sample. fn runs with the
+// player locked: it must return quickly and not call the player. Exact seeks
+// do not report the frames they skip. The returned function cancels the
+// subscription.
+func (ym *CYmMusic) SubscribeFrames(fn func(FrameEvent)) (cancel func()) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+
+	ym.nextSubscriber++
+	id := ym.nextSubscriber
+	ym.subscribers = append(ym.subscribers, frameSubscriber{id, fn})
+
+	return func() {
+		ym.mutex.Lock()
+		defer ym.mutex.Unlock()
+		ym.subscribers = slices.DeleteFunc(ym.subscribers, func(s frameSubscriber) bool {
+			return s.id == id
+		})
+	}
+}
+
+// startEffect records an effect started by the frame being played
+func (ym *CYmMusic) startEffect(kind EffectType, voice, freq YmInt) {
+	effect := Effect{Type: kind, Voice: int(voice), Freq: int(freq)}
+	ym.frameEffects = append(ym.frameEffects, effect)
+	if kind == EffectDigiDrum {
+		ym.drumEffects[voice] = effect.Freq
+	}
+}
+
+// frameEvent reports the frame just written by player() to the subscribers,
+// offset is the position of its first sample in the output buffer
+func (ym *CYmMusic) frameEvent(offset int) {
+	if len(ym.subscribers) == 0 || ym.bMusicOver {
+		return
+	}
+
+	event := FrameEvent{Frame: ym.currentFrame - 1, Offset: offset}
+	for reg := 0; reg < 14; reg++ {
+		event.Registers[reg] = byte(ym.ymChip.registers[reg])
+	}
+	if ym.streamInc > 15 {
+		frame := ym.pDataStream[event.Frame*ym.streamInc:]
+		event.Registers[14], event.Registers[15] = frame[14], frame[15]
+	}
+
+	// Les digidrums durent plusieurs frames, les autres effets sont relancés
+	// à chaque frame
+	event.Effects = slices.Clone(ym.frameEffects)
+	for voice := range ym.drumEffects {
+		started := slices.ContainsFunc(ym.frameEffects, func(e Effect) bool {
+			return e.Type == EffectDigiDrum && e.Voice == voice
+		})
+		if !started && bool(ym.ymChip.specialEffect[voice].Drum) {
+			// Fréquence inconnue (0) pour un digidrum lancé avant un Restore
+			event.Effects = append(event.Effects, Effect{Type: EffectDigiDrum, Voice: voice, Freq: ym.drumEffects[voice]})
+		}
+	}
+
+	for _, s := range ym.subscribers {
+		s.fn(event)
+	}
+}
@@ -0,0 +1,66 @@
+package stsound
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSubscribeFrames(t *testing.T) {
+	data := seekSong(t)
+	ym := NewYmMusic(44100)
+	if err := ym.LoadMemory(data); err != nil {
+		t.Fatal(err)
+	}
+	var events []FrameEvent
+	var chunkStart int
+	cancel := ym.SubscribeFrames(func(e FrameEvent) {
+		e.Offset += chunkStart // position dans tout le rendu
+		events = append(events, e)
+	})
+
+	ym.Play()
+	buffer := make([]YmSample, 1000)
+	for chunkStart = 0; chunkStart < 4*44100; chunkStart += len(buffer) {
+		ym.Update(buffer, len(buffer))
+	}
+	if len(events) != 201 {
+		t.Fatalf("%d events for 4s, want 201", len(events))
+	}
+	for i, e := range events {
+		frame := ym.pDataStream[i*16 : (i+1)*16]
+		if e.Frame != i || e.Offset != i*882 {
+			t.Fatalf("event %d: frame %d at %d, want %d", i, e.Frame, e.Offset, i*882)
+		}
+		// Le chip ne garde que les bits utiles, r13 0xff ne l'écrit pas
+		masks := [16]byte{0xff, 15, 0xff, 15, 0xff, 15, 31, 0xff, 31, 31, 31, 0xff, 0xff, 0, 0xff, 0xff}
+		for reg, mask := range masks {
+			if reg != 13 && e.Registers[reg] != frame[reg]&mask {
+				t.Fatalf("frame %d: registers %v, want %v", i, e.Registers, frame)
+			}
+		}
+		// Digidrum 0 sur la voix B, timer à 2457600/(4*20) Hz
+		wantDrum := i == 160
+		if hasDrum := slices.Contains(e.Effects, Effect{EffectDigiDrum, 1, 30720}); hasDrum != wantDrum {
+			t.Errorf("frame %d: effects %v", i, e.Effects)
+		}
+	}
+
+	// Les frames sautées par un seek ne sont pas signalées
+	events = nil
+	ym.SetMusicTime(10000)
+	if len(events) != 0 {
+		t.Errorf("%d events during the seek", len(events))
+	}
+	chunkStart = 0
+	ym.Update(buffer, len(buffer))
+	if len(events) != 2 || events[0].Frame != 500 || events[0].Offset != 0 {
+		t.Errorf("events after the seek: %+v", events)
+	}
+
+	cancel()
+	events = nil
+	ym.Update(buffer, len(buffer))
+	if len(events) != 0 {
+		t.Errorf("%d events after cancel", len(events))
+	}
+}
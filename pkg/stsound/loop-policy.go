@@ -0,0 +1,164 @@
+package stsound
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// FadeCurve shapes the fade-out of a LoopPolicy
+type FadeCurve int
+
+const (
+	// FadeLinear lowers the amplitude linearly (default)
+	FadeLinear FadeCurve = iota
+	// FadeCosine starts and ends smoothly (half cosine)
+	FadeCosine
+	// FadeExponential lowers the level linearly in dB, down to -60dB
+	FadeExponential
+)
+
+func (c FadeCurve) String() string {
+	switch c {
+	case FadeLinear:
+		return "linear"
+	case FadeCosine:
+		return "cosine"
+	case FadeExponential:
+		return "exp"
+	}
+	return "unknown"
+}
+
+// ParseFadeCurve accepts "linear", "cosine" or "exp"
+func ParseFadeCurve(s string) (FadeCurve, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "linear":
+		return FadeLinear, nil
+	case "cosine", "cos":
+		return FadeCosine, nil
+	case "exp", "exponential":
+		return FadeExponential, nil
+	}
+	return FadeLinear, fmt.Errorf("unknown fade curve %q: expected linear, cosine or exp", s)
+}
+
+// gain returns the amplitude at x (0..1) of the fade
+func (c FadeCurve) gain(x float64) float64 {
+	switch c {
+	case FadeCosine:
+		return 0.5 * (1 + math.Cos(math.Pi*x))
+	case FadeExponential:
+		return math.Pow(10, -3*x)
+	}
+	return 1 - x
+}
+
+// LoopPolicy plays a song a given number of times, then fades it out while
+// it keeps looping. It takes precedence over SetLoopMode.
+type LoopPolicy struct {
+	Loops int           // Passes through the song, the first one included; 0 disables the policy
+	Fade  time.Duration // Fade-out after the last pass, 0 to stop right away
+	Curve FadeCurve
+}
+
+// SetLoopPolicy sets the number of loops and the fade-out. GetMusicTime and
+// GetPos then follow the whole rendering: loops and fade included.
+func (ym *CYmMusic) SetLoopPolicy(policy LoopPolicy) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.loopPolicy = policy
+}
+
+// GetLoopPolicy returns the loop policy in use
+func (ym *CYmMusic) GetLoopPolicy() LoopPolicy {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.loopPolicy
+}
+
+func (ym *CYmMusic) hasLoopPolicy() bool {
+	return ym.loopPolicy.Loops > 0
+}
+
+// looping tells the replay routines to go back to the loop point at the end
+func (ym *CYmMusic) looping() YmBool {
+	return ym.bLoop || YmBool(ym.hasLoopPolicy())
+}
+
+// songTime is the length of one pass through the song
+func (ym *CYmMusic) songTime() YmU32 {
+	if ym.songType >= YM_MIX1 && ym.songType < YM_MIXMAX {
+		return ym.musicLenInMs
+	} else if ym.nbFrame > 0 && ym.playerRate > 0 {
+		return YmU32(ym.nbFrame) * 1000 / YmU32(ym.playerRate)
+	}
+	return 0
+}
+
+// loopStart is the time the song goes back to at the end of a pass
+func (ym *CYmMusic) loopStart() YmU32 {
+	if ym.songType >= YM_MIX1 && ym.songType < YM_MIXMAX {
+		return 0
+	} else if ym.playerRate > 0 {
+		return YmU32(ym.loopFrame) * 1000 / YmU32(ym.playerRate)
+	}
+	return 0
+}
+
+// policyTimes returns when the fade starts and when the song ends, in ms
+func (ym *CYmMusic) policyTimes() (YmU32, YmU32) {
+	fadeStart := ym.songTime() + YmU32(ym.loopPolicy.Loops-1)*(ym.songTime()-ym.loopStart())
+	return fadeStart, fadeStart + YmU32(ym.loopPolicy.Fade.Milliseconds())
+}
+
+// policySamples is policyTimes in samples
+func (ym *CYmMusic) policySamples() (int64, int64) {
+	fadeStart, end := ym.policyTimes()
+	return int64(fadeStart) * int64(ym.replayRate) / 1000, int64(end) * int64(ym.replayRate) / 1000
+}
+
+// passTime maps a time of the whole rendering to a time within the song
+func (ym *CYmMusic) passTime(time YmU32) YmU32 {
+	song, start := ym.songTime(), ym.loopStart()
+	if time < song || song <= start {
+		return time
+	}
+	return start + (time-song)%(song-start)
+}
+
+// fadeOut applies the fade-out of the loop policy to samples that start at
+// sample position start
+func (ym *CYmMusic) fadeOut(pBuffer []YmSample, nbSample, channels int, start int64) {
+	if !ym.hasLoopPolicy() {
+		return
+	}
+	fadeStart, end := ym.policySamples()
+	if start+int64(nbSample) <= fadeStart {
+		return
+	}
+
+	for i := 0; i < nbSample; i++ {
+		pos := start + int64(i)
+		if pos < fadeStart {
+			continue
+		}
+		gain := int64(0)
+		if pos < end {
+			gain = int64(ym.loopPolicy.Curve.gain(float64(pos-fadeStart)/float64(end-fadeStart)) * 65536)
+		}
+		for c := i * channels; c < (i+1)*channels; c++ {
+			pBuffer[c] = YmSample(int64(pBuffer[c]) * gain >> 16)
+		}
+	}
+}
+
+// policyOver tells if the loop policy has ended the song
+func (ym *CYmMusic) policyOver() bool {
+	if !ym.hasLoopPolicy() {
+		return false
+	}
+	_, end := ym.policySamples()
+	return ym.playedSamples >= end
+}
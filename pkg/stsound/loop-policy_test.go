@@ -0,0 +1,94 @@
+package stsound
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoopPolicy(t *testing.T) {
+	data := seekSong(t)
+	const rate = 44100
+	policy := LoopPolicy{Loops: 2, Fade: 2 * time.Second, Curve: FadeCosine}
+
+	newPlayer := func(policy LoopPolicy) *CYmMusic {
+		ym := NewYmMusic(rate)
+		if err := ym.LoadMemory(data); err != nil {
+			t.Fatal(err)
+		}
+		ym.SetLoopPolicy(policy)
+		ym.Play()
+		return ym
+	}
+	render := func(ym *CYmMusic, seconds int) []YmSample {
+		var out []YmSample
+		buffer := make([]YmSample, 1000)
+		for len(out) < seconds*rate && ym.Update(buffer, len(buffer)) {
+			out = append(out, buffer...)
+		}
+		return out
+	}
+
+	ym := newPlayer(policy)
+	if got := ym.GetMusicTime(); got != 2*14000+2000 {
+		t.Fatalf("GetMusicTime = %d, want 30000", got)
+	}
+	got := render(ym, 60)
+	if len(got) < 30*rate || len(got) > 30*rate+1000 {
+		t.Errorf("rendered %d samples, want %d", len(got), 30*rate)
+	}
+	if pos := ym.GetPos(); pos < 30000 {
+		t.Errorf("GetPos = %d at the end, want 30000", pos)
+	}
+
+	// Deux passages identiques à la lecture en boucle, puis le fondu
+	loop := NewYmMusic(rate)
+	loop.LoadMemory(data)
+	loop.SetLoopMode(YmTrue)
+	loop.Play()
+	want := render(loop, 30)
+	fadeStart := 28 * rate
+	if !slices.Equal(got[:fadeStart], want[:fadeStart]) {
+		t.Error("the loops differ from looping playback")
+	}
+	var fadeEnergy, loopEnergy int64
+	for i := fadeStart; i < 30*rate; i++ {
+		fadeEnergy += int64(got[i]) * int64(got[i])
+		loopEnergy += int64(want[i]) * int64(want[i])
+	}
+	if fadeEnergy == 0 || fadeEnergy >= loopEnergy/2 {
+		t.Errorf("fade energy %d for %d without fade", fadeEnergy, loopEnergy)
+	}
+	for _, s := range got[30*rate:] {
+		if s != 0 {
+			t.Fatal("samples after the end of the fade")
+		}
+	}
+
+	// Un seek exact dans la seconde boucle retombe sur la lecture linéaire
+	ym = newPlayer(policy)
+	ym.SetMusicTime(20000)
+	after := render(ym, 1)
+	if !slices.Equal(after[:rate], got[20*rate:21*rate]) {
+		t.Error("seek into the second loop differs from linear playback")
+	}
+}
+
+func TestFadeCurves(t *testing.T) {
+	for _, curve := range []FadeCurve{FadeLinear, FadeCosine, FadeExponential} {
+		last := curve.gain(0)
+		if last != 1 {
+			t.Errorf("%s: gain(0) = %g", curve, last)
+		}
+		for x := 0.01; x < 1; x += 0.01 {
+			g := curve.gain(x)
+			if g > last || g < 0 {
+				t.Errorf("%s: gain(%g) = %g after %g", curve, x, g, last)
+			}
+			last = g
+		}
+		if parsed, err := ParseFadeCurve(curve.String()); err != nil || parsed != curve {
+			t.Errorf("ParseFadeCurve(%q) = %v, %v", curve, parsed, err)
+		}
+	}
+}
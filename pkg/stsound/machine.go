@@ -0,0 +1,115 @@
+package stsound
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Machine bundles the settings of a computer fitted with a YM2149 or an
+// AY-3-8910. Forcing a machine on load overrides the clock and player rate
+// of the file header: YM2/YM3 files always announce an Atari ST.
+type Machine struct {
+	ID         string // Short name, as given on the command line
+	Name       string
+	Clock      YmU32 // Chip master clock
+	PlayerRate int   // Frames per second
+	Chip       ChipModel
+	Stereo     StereoMode
+	LowPass    bool
+}
+
+// Built-in profiles, handed out as copies by MachineProfiles and FindMachine
+// so that callers cannot change them
+var machines = []Machine{
+	{
+		ID: "st", Name: "Atari ST",
+		Clock: ATARI_CLOCK, PlayerRate: 50,
+		Chip: ChipYM2149, Stereo: StereoMono, LowPass: true,
+	},
+	{
+		ID: "cpc", Name: "Amstrad CPC",
+		Clock: AMSTRAD_CLOCK, PlayerRate: 50,
+		Chip: ChipAY8910, Stereo: StereoABC, LowPass: true,
+	},
+	// Le 128K est mono, ACB est le câblage des interfaces stéréo courantes
+	{
+		ID: "spectrum", Name: "ZX Spectrum 128",
+		Clock: SPECTRUM_CLOCK, PlayerRate: 50,
+		Chip: ChipAY8910, Stereo: StereoACB, LowPass: true,
+	},
+	// MSX japonais (NTSC), 60 trames par seconde
+	{
+		ID: "msx", Name: "MSX",
+		Clock: MSX_CLOCK, PlayerRate: 60,
+		Chip: ChipAY8910, Stereo: StereoMono, LowPass: true,
+	},
+}
+
+// MachineProfiles returns a copy of the built-in profiles: Atari ST, Amstrad
+// CPC, ZX Spectrum and MSX
+func MachineProfiles() []Machine {
+	return slices.Clone(machines)
+}
+
+// FindMachine looks a profile up by ID or name, case insensitive
+func FindMachine(name string) (Machine, error) {
+	name = strings.TrimSpace(name)
+	for _, m := range machines {
+		if strings.EqualFold(name, m.ID) || strings.EqualFold(name, m.Name) {
+			return m, nil
+		}
+	}
+
+	ids := make([]string, len(machines))
+	for i, m := range machines {
+		ids[i] = m.ID
+	}
+	return Machine{}, fmt.Errorf("unknown machine %q: expected %s", name, strings.Join(ids, ", "))
+}
+
+// SetMachine forces a machine profile. The chip model, stereo layout and
+// filter are applied at once, the clock and player rate replace those of the
+// file header for the loaded song and the next ones. nil goes back to the
+// header values. The profile is copied.
+func (ym *CYmMusic) SetMachine(m *Machine) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+
+	ym.machine = nil
+	if m != nil {
+		profile := *m
+		ym.machine = &profile
+		ym.ymChip.SetChipModel(m.Chip)
+		ym.ymChip.SetPanning(m.Stereo.Pans())
+		ym.ymChip.SetFilter(YmBool(m.LowPass))
+	}
+	if ym.bMusicOk {
+		ym.applyMachineTiming()
+	}
+	ym.keyframes = nil
+}
+
+// GetMachine returns a copy of the forced profile, nil if the file header
+// is used
+func (ym *CYmMusic) GetMachine() *Machine {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	if ym.machine == nil {
+		return nil
+	}
+	profile := *ym.machine
+	return &profile
+}
+
+// applyMachineTiming sets the clock and player rate of the forced machine,
+// or those read from the header when no machine is forced
+func (ym *CYmMusic) applyMachineTiming() {
+	if ym.machine != nil {
+		ym.ymChip.SetClock(ym.machine.Clock)
+		ym.setPlayerRate(ym.machine.PlayerRate)
+	} else {
+		ym.ymChip.SetClock(ym.headerClock)
+		ym.setPlayerRate(int(ym.headerPlayerRate))
+	}
+}
@@ -0,0 +1,82 @@
+package stsound
+
+import "testing"
+
+// A forced profile replaces the clock and player rate of the YM5/YM6 header,
+// whether it is set before or after loading
+func TestMachineOverridesHeader(t *testing.T) {
+	msx, err := FindMachine("msx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, format := range map[string]YmFileType{"YM5": YM_V5, "YM6": YM_V6} {
+		song := &YmSong{Format: format, Frames: make([][16]byte, 120), Clock: ATARI_CLOCK, PlayerRate: 50}
+		data, err := EncodeYM(song)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, before := range []bool{true, false} {
+			ym := NewYmMusic(44100)
+			if before {
+				ym.SetMachine(&msx)
+			}
+			if err := ym.LoadMemory(data); err != nil {
+				t.Fatal(err)
+			}
+			if !before {
+				ym.SetMachine(&msx)
+			}
+			check := func(clock YmU32, rate YmInt, ms YmU32, chip ChipModel) {
+				t.Helper()
+				if ym.ymChip.internalClock != clock || ym.playerRate != rate {
+					t.Errorf("%s: %dHz at %d frames/s, want %dHz at %d", name,
+						ym.ymChip.internalClock, ym.playerRate, clock, rate)
+				}
+				if got := ym.GetMusicInfo().MusicTimeInMs; got != ms {
+					t.Errorf("%s: length %dms, want %dms", name, got, ms)
+				}
+				if got := ym.ymChip.GetChipModel(); got != chip {
+					t.Errorf("%s: chip %s, want %s", name, got, chip)
+				}
+			}
+			check(MSX_CLOCK, 60, 2000, ChipAY8910)
+
+			// nil revient à l'en-tête, le modèle de chip reste celui du profil
+			ym.SetMachine(nil)
+			check(ATARI_CLOCK, 50, 2400, ChipAY8910)
+		}
+	}
+}
+
+// Built-in profiles are handed out as copies
+func TestMachineProfiles(t *testing.T) {
+	profiles := MachineProfiles()
+	if len(profiles) != 4 || profiles[0].ID != "st" {
+		t.Fatalf("profiles: %+v", profiles)
+	}
+	profiles[0].Clock = 1
+	st, err := FindMachine("Atari ST")
+	if err != nil || st.Clock != ATARI_CLOCK {
+		t.Fatalf("FindMachine after a change of MachineProfiles: %+v, %v", st, err)
+	}
+	if MachineProfiles()[0].Clock != ATARI_CLOCK {
+		t.Error("MachineProfiles returns the built-in table")
+	}
+
+	ym := NewYmMusic(44100)
+	ym.SetMachine(&st)
+	st.PlayerRate = 25
+	got := ym.GetMachine()
+	if got.PlayerRate != 50 {
+		t.Error("SetMachine keeps the caller's profile")
+	}
+	got.PlayerRate = 25
+	if ym.GetMachine().PlayerRate != 50 {
+		t.Error("GetMachine returns the forced profile itself")
+	}
+
+	if _, err := FindMachine("c64"); err == nil {
+		t.Error(`FindMachine("c64") succeeded`)
+	}
+}
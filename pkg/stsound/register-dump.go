@@ -0,0 +1,612 @@
+package stsound
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DumpFormat selects the layout of a register dump
+type DumpFormat int
+
+const (
+	// DumpText is a tracker-style table, one line per frame (default)
+	DumpText DumpFormat = iota
+	// DumpCSV has one row per frame, for spreadsheets and diff tools
+	DumpCSV
+	// DumpJSONL has one JSON object per line, the song header first
+	DumpJSONL
+)
+
+func (f DumpFormat) String() string {
+	switch f {
+	case DumpText:
+		return "text"
+	case DumpCSV:
+		return "csv"
+	case DumpJSONL:
+		return "jsonl"
+	}
+	return "unknown"
+}
+
+// ParseDumpFormat accepts "text", "csv" or "jsonl"
+func ParseDumpFormat(s string) (DumpFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "text", "txt":
+		return DumpText, nil
+	case "csv":
+		return DumpCSV, nil
+	case "jsonl", "json":
+		return DumpJSONL, nil
+	}
+	return DumpText, fmt.Errorf("unknown dump format %q: expected text, csv or jsonl", s)
+}
+
+// Song returns the register frames of the loaded YM2 to YM6 song as a YM5
+// or YM6 song, for EncodeYM or DumpSong. YM2 and YM3 songs have no effects:
+// the effect bits of their frames are cleared. The envelope writes of YM2
+// songs are those of the Mad Max driver, their digidrums are not kept.
+func (ym *CYmMusic) Song() (*YmSong, error) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+
+	if !ym.bMusicOk || ym.songType < YM_V2 || ym.songType >= YM_VMAX {
+		return nil, fmt.Errorf("%w: only YM2 to YM6 songs have register frames", ErrUnsupportedFormat)
+	}
+
+	song := &YmSong{
+		Format:      YM_V5,
+		Frames:      make([][16]byte, ym.nbFrame),
+		LoopFrame:   ym.loopFrame,
+		Clock:       ym.headerClock,
+		PlayerRate:  int(ym.headerPlayerRate),
+		SongName:    ym.pSongName,
+		SongAuthor:  ym.pSongAuthor,
+		SongComment: ym.pSongComment,
+	}
+	if ym.songType == YM_V6 {
+		song.Format = YM_V6
+	}
+	var env [2]byte
+	for i := range song.Frames {
+		f := &song.Frames[i]
+		copy(f[:], ym.pDataStream[i*ym.streamInc:(i+1)*ym.streamInc])
+		if ym.songType <= YM_V3 {
+			f[1] &= 15
+			f[3] &= 15
+		}
+		if ym.songType == YM_V2 {
+			// Le driver Mad Max n'écrit l'enveloppe qu'avec r13, toujours en forme 10
+			f[10] &= 0x7f
+			if f[13] != 0xff {
+				env = [2]byte{f[11], 0}
+				f[13] = 10
+			}
+			f[11], f[12] = env[0], env[1]
+		}
+	}
+	for _, drum := range ym.pDrumTab[:ym.nbDrum] {
+		song.DigiDrums = append(song.DigiDrums, DigiDrum{Size: drum.Size, Data: slices.Clone(drum.Data)})
+	}
+	return song, nil
+}
+
+// Champs décodés d'une frame : seuls les registres bruts sont relus
+type dumpVoice struct {
+	Period   int    `json:"period"`
+	Note     string `json:"note"`
+	Volume   int    `json:"volume"`
+	Envelope bool   `json:"envelope"`
+	Tone     bool   `json:"tone"`
+	Noise    bool   `json:"noise"`
+}
+
+type dumpEffect struct {
+	Type  string `json:"type"`
+	Voice string `json:"voice"`
+	Freq  int    `json:"freq"`
+	Drum  *int   `json:"drum,omitempty"`
+}
+
+type dumpFrame struct {
+	Frame     int          `json:"frame"`
+	Regs      [16]byte     `json:"regs"`
+	Voices    [3]dumpVoice `json:"voices"`
+	Noise     int          `json:"noise"`
+	EnvPeriod int          `json:"env_period"`
+	EnvShape  *int         `json:"env_shape"` // null: r13 is 0xff, the envelope is not restarted
+	Effects   []dumpEffect `json:"effects,omitempty"`
+}
+
+type dumpHeader struct {
+	Format  string   `json:"format"`
+	Clock   YmU32    `json:"clock"`
+	Rate    int      `json:"rate"`
+	Loop    int      `json:"loop"`
+	Name    string   `json:"name"`
+	Author  string   `json:"author"`
+	Comment string   `json:"comment"`
+	Drums   [][]byte `json:"drums,omitempty"`
+}
+
+var noteNames = [12]string{"C-", "C#", "D-", "D#", "E-", "F-", "F#", "G-", "G#", "A-", "A#", "B-"}
+
+// noteName returns the note closest to a tone period, "---" when the
+// period is not a note
+func noteName(period int, clock YmU32) string {
+	if period == 0 {
+		return "---"
+	}
+	freq := float64(clock) / (16 * float64(period))
+	midi := int(math.Round(69 + 12*math.Log2(freq/440)))
+	if midi < 0 || midi > 127 {
+		return "---"
+	}
+	return noteNames[midi%12] + strconv.Itoa(midi/12-1)
+}
+
+// Effets YM6, selon les bits 6-7 du code
+var ym6Effects = [4]EffectType{EffectSID, EffectDigiDrum, EffectSinusSID, EffectSyncBuzzer}
+
+// effects decodes the special effects started by a frame, as the YM5 and
+// YM6 players read them
+func (song *YmSong) effects(f *[16]byte) []dumpEffect {
+	var effects []dumpEffect
+	add := func(kind EffectType, voice int, prediv, count byte, drum int) {
+		p := int(mfpPrediv[(prediv>>5)&7]) * int(count)
+		if p == 0 || (kind == EffectDigiDrum && drum >= len(song.DigiDrums)) {
+			return
+		}
+		e := dumpEffect{Type: kind.String(), Voice: string(rune('A' + voice)), Freq: MFP_CLOCK / p}
+		if kind == EffectDigiDrum {
+			e.Drum = &drum
+		}
+		effects = append(effects, e)
+	}
+
+	if song.Format != YM_V6 {
+		if code := (f[1] >> 4) & 3; code != 0 {
+			add(EffectSID, int(code-1), f[6], f[14], 0)
+		}
+		if code := (f[3] >> 4) & 3; code != 0 {
+			add(EffectDigiDrum, int(code-1), f[8], f[15], int(f[8+code-1]&31))
+		}
+		return effects
+	}
+
+	for _, slot := range [2][3]int{{1, 6, 14}, {3, 8, 15}} {
+		code := f[slot[0]] & 0xf0
+		if code&0x30 == 0 {
+			continue
+		}
+		voice := int(code&0x30)>>4 - 1
+		add(ym6Effects[code>>6], voice, f[slot[1]], f[slot[2]], int(f[voice+8]&31))
+	}
+	return effects
+}
+
+// decodeFrame fills the decoded fields of frame i
+func (song *YmSong) decodeFrame(i int) dumpFrame {
+	f := &song.Frames[i]
+	clock := song.Clock
+	if clock == 0 {
+		clock = ATARI_CLOCK
+	}
+
+	d := dumpFrame{Frame: i, Regs: *f, Noise: int(f[6] & 31), EnvPeriod: int(f[12])<<8 | int(f[11])}
+	for v := range d.Voices {
+		period := int(f[2*v+1]&15)<<8 | int(f[2*v])
+		d.Voices[v] = dumpVoice{
+			Period:   period,
+			Note:     noteName(period, clock),
+			Volume:   int(f[8+v] & 15),
+			Envelope: f[8+v]&0x10 != 0,
+			Tone:     f[7]&(1<<v) == 0,
+			Noise:    f[7]&(8<<v) == 0,
+		}
+	}
+	if f[13] != 0xff {
+		shape := int(f[13] & 15)
+		d.EnvShape = &shape
+	}
+	d.Effects = song.effects(f)
+	return d
+}
+
+func (d *dumpFrame) mixer() string {
+	m := []byte("---/---")
+	for v, voice := range d.Voices {
+		if voice.Tone {
+			m[v] = byte('A' + v)
+		}
+		if voice.Noise {
+			m[4+v] = byte('a' + v)
+		}
+	}
+	return string(m)
+}
+
+func (d *dumpFrame) effectList() string {
+	var list []string
+	for _, e := range d.Effects {
+		s := e.Voice + " " + e.Type
+		if e.Drum != nil {
+			s += " #" + strconv.Itoa(*e.Drum)
+		}
+		list = append(list, s+" "+strconv.Itoa(e.Freq)+"Hz")
+	}
+	return strings.Join(list, ", ")
+}
+
+func (v *dumpVoice) volume() string {
+	if v.Envelope {
+		return "env"
+	}
+	return strconv.Itoa(v.Volume)
+}
+
+func (d *dumpFrame) envShape() string {
+	if d.EnvShape == nil {
+		return "--"
+	}
+	return fmt.Sprintf("%02X", *d.EnvShape)
+}
+
+func (song *YmSong) header() dumpHeader {
+	h := dumpHeader{
+		Format:  "YM5",
+		Clock:   song.Clock,
+		Rate:    song.PlayerRate,
+		Loop:    song.LoopFrame,
+		Name:    song.SongName,
+		Author:  song.SongAuthor,
+		Comment: song.SongComment,
+	}
+	if song.Format == YM_V6 {
+		h.Format = "YM6"
+	}
+	if h.Clock == 0 {
+		h.Clock = ATARI_CLOCK
+	}
+	if h.Rate == 0 {
+		h.Rate = 50
+	}
+	for _, drum := range song.DigiDrums {
+		data := make([]byte, drum.Size)
+		for i := range data {
+			data[i] = byte(drum.Data[i])
+		}
+		h.Drums = append(h.Drums, data)
+	}
+	return h
+}
+
+// DumpSong writes the frames of a song with their decoded fields: tone
+// periods and notes, volumes, mixer, noise, envelope and effects. Every
+// format also holds the raw registers r0-r15 and the song header, which is
+// all ReadDump needs to rebuild the song.
+func DumpSong(w io.Writer, song *YmSong, format DumpFormat) error {
+	if err := song.validate(); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	h := song.header()
+
+	switch format {
+	case DumpJSONL:
+		enc := json.NewEncoder(bw)
+		if err := enc.Encode(h); err != nil {
+			return err
+		}
+		for i := range song.Frames {
+			if err := enc.Encode(song.decodeFrame(i)); err != nil {
+				return err
+			}
+		}
+
+	case DumpCSV, DumpText:
+		fmt.Fprintf(bw, "# ymplayer register dump: only r0-r15 are read back, the other columns are decoded from them\n")
+		fmt.Fprintf(bw, "# format: %s\n# clock: %d\n# rate: %d\n# loop: %d\n", h.Format, h.Clock, h.Rate, h.Loop)
+		fmt.Fprintf(bw, "# name: %s\n# author: %s\n# comment: %s\n", strconv.Quote(h.Name), strconv.Quote(h.Author), strconv.Quote(h.Comment))
+		for _, drum := range h.Drums {
+			fmt.Fprintf(bw, "# drum: %s\n", base64.StdEncoding.EncodeToString(drum))
+		}
+		if format == DumpText {
+			song.dumpText(bw)
+		} else if err := song.dumpCSV(bw); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown dump format: %d", format)
+	}
+	return bw.Flush()
+}
+
+func (song *YmSong) dumpText(w io.Writer) {
+	fmt.Fprintf(w, "#frame | A per note vol | B per note vol | C per note vol | nz mixer  | env  sh | r0 r1 r2 r3 r4 r5 r6 r7 r8 r9 10 11 12 13 14 15 | effects\n")
+	for i := range song.Frames {
+		d := song.decodeFrame(i)
+		fmt.Fprintf(w, "%06d ", d.Frame)
+		for _, v := range d.Voices {
+			fmt.Fprintf(w, "| %03X %-4s %3s  ", v.Period, v.Note, v.volume())
+		}
+		fmt.Fprintf(w, "| %02X %s | %04X %s | % X |", d.Noise, d.mixer(), d.EnvPeriod, d.envShape(), d.Regs[:])
+		if effects := d.effectList(); effects != "" {
+			fmt.Fprintf(w, " %s", effects)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func (song *YmSong) dumpCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"frame"}
+	for reg := 0; reg < 16; reg++ {
+		header = append(header, "r"+strconv.Itoa(reg))
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		header = append(header, v+"_period", v+"_note", v+"_volume")
+	}
+	header = append(header, "noise", "mixer", "env_period", "env_shape", "effects")
+	cw.Write(header)
+
+	for i := range song.Frames {
+		d := song.decodeFrame(i)
+		row := []string{strconv.Itoa(d.Frame)}
+		for _, r := range d.Regs {
+			row = append(row, strconv.Itoa(int(r)))
+		}
+		for _, v := range d.Voices {
+			row = append(row, strconv.Itoa(v.Period), v.Note, v.volume())
+		}
+		row = append(row, strconv.Itoa(d.Noise), d.mixer(), strconv.Itoa(d.EnvPeriod), d.envShape(), d.effectList())
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadDump turns a dump written by DumpSong, possibly edited, back into a
+// song. The format is detected. Only the header and the r0-r15 registers
+// are read: frame numbers and decoded fields are ignored, the frames follow
+// the order of the lines. A missing header gives a YM6 song at 2MHz and 50Hz.
+func ReadDump(r io.Reader) (*YmSong, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20) // Les digidrums tiennent sur une ligne
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	h := dumpHeader{Format: "YM6", Clock: ATARI_CLOCK, Rate: 50}
+	var frames [][16]byte
+	var err error
+
+	first := slices.IndexFunc(lines, func(line string) bool {
+		line = strings.TrimSpace(line)
+		return line != "" && !strings.HasPrefix(line, "#")
+	})
+	switch {
+	case first >= 0 && strings.HasPrefix(strings.TrimSpace(lines[first]), "{"):
+		frames, err = readJSONLDump(lines, &h)
+	case first >= 0 && strings.HasPrefix(strings.TrimSpace(lines[first]), "frame,"):
+		if err = readDumpHeader(lines, &h); err == nil {
+			frames, err = readCSVDump(lines[first:], first)
+		}
+	default:
+		if err = readDumpHeader(lines, &h); err == nil {
+			frames, err = readTextDump(lines)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	song := &YmSong{
+		Frames:      frames,
+		LoopFrame:   h.Loop,
+		Clock:       h.Clock,
+		PlayerRate:  h.Rate,
+		SongName:    h.Name,
+		SongAuthor:  h.Author,
+		SongComment: h.Comment,
+	}
+	switch strings.ToUpper(h.Format) {
+	case "YM5":
+		song.Format = YM_V5
+	case "YM6":
+		song.Format = YM_V6
+	default:
+		return nil, fmt.Errorf("%w: format %q, expected YM5 or YM6", ErrBadDump, h.Format)
+	}
+	for _, data := range h.Drums {
+		drum := DigiDrum{Size: YmU32(len(data)), Data: make([]YmU8, len(data))}
+		for i, b := range data {
+			drum.Data[i] = YmU8(b)
+		}
+		song.DigiDrums = append(song.DigiDrums, drum)
+	}
+	if err := song.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadDump, err)
+	}
+	return song, nil
+}
+
+// readDumpHeader reads the "# key: value" comment lines of the text and
+// CSV dumps, other comments are ignored
+func readDumpHeader(lines []string, h *dumpHeader) error {
+	for n, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(line[1:]), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		var err error
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "format":
+			h.Format = value
+		case "clock":
+			var clock uint64
+			clock, err = strconv.ParseUint(value, 10, 32)
+			h.Clock = YmU32(clock)
+		case "rate":
+			h.Rate, err = strconv.Atoi(value)
+		case "loop":
+			h.Loop, err = strconv.Atoi(value)
+		case "name":
+			h.Name = unquoteDump(value)
+		case "author":
+			h.Author = unquoteDump(value)
+		case "comment":
+			h.Comment = unquoteDump(value)
+		case "drum":
+			var drum []byte
+			drum, err = base64.StdEncoding.DecodeString(value)
+			h.Drums = append(h.Drums, drum)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %v", ErrBadDump, n+1, err)
+		}
+	}
+	return nil
+}
+
+// unquoteDump accepts a quoted string, or the raw text typed by hand
+func unquoteDump(s string) string {
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return s
+}
+
+// readTextDump reads the registers column of each frame line: the one made
+// of 16 hex bytes
+func readTextDump(lines []string) ([][16]byte, error) {
+	var frames [][16]byte
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		found := false
+		for _, column := range strings.Split(line, "|") {
+			values := strings.Fields(column)
+			if len(values) != 16 {
+				continue
+			}
+			var frame [16]byte
+			found = true
+			for reg, s := range values {
+				v, err := strconv.ParseUint(s, 16, 8)
+				if err != nil || len(s) != 2 {
+					found = false
+					break
+				}
+				frame[reg] = byte(v)
+			}
+			if found {
+				frames = append(frames, frame)
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: line %d: no r0-r15 column of 16 hex bytes", ErrBadDump, n+1)
+		}
+	}
+	return frames, nil
+}
+
+// readCSVDump reads the r0-r15 columns, wherever the header puts them
+func readCSVDump(lines []string, offset int) ([][16]byte, error) {
+	var data []string
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			data = append(data, line)
+		}
+	}
+	cr := csv.NewReader(strings.NewReader(strings.Join(data, "\n")))
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadDump, err)
+	}
+
+	var columns [16]int
+	for reg := range columns {
+		columns[reg] = slices.Index(records[0], "r"+strconv.Itoa(reg))
+		if columns[reg] < 0 {
+			return nil, fmt.Errorf("%w: line %d: no r%d column", ErrBadDump, offset+1, reg)
+		}
+	}
+
+	var frames [][16]byte
+	for n, record := range records[1:] {
+		var frame [16]byte
+		for reg, column := range columns {
+			if column >= len(record) {
+				return nil, fmt.Errorf("%w: row %d: no r%d value", ErrBadDump, n+1, reg)
+			}
+			v, err := strconv.ParseUint(strings.TrimSpace(record[column]), 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("%w: row %d: r%d: %v", ErrBadDump, n+1, reg, err)
+			}
+			frame[reg] = byte(v)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// readJSONLDump reads the header object, optional, then one frame per line
+func readJSONLDump(lines []string, h *dumpHeader) ([][16]byte, error) {
+	var frames [][16]byte
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var object struct {
+			dumpHeader
+			Regs []int `json:"regs"`
+		}
+		object.dumpHeader = *h
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrBadDump, n+1, err)
+		}
+		switch {
+		case object.Regs != nil:
+			var frame [16]byte
+			if len(object.Regs) != len(frame) {
+				return nil, fmt.Errorf("%w: line %d: %d registers, want 16", ErrBadDump, n+1, len(object.Regs))
+			}
+			for reg, v := range object.Regs {
+				if v < 0 || v > 255 {
+					return nil, fmt.Errorf("%w: line %d: r%d out of range: %d", ErrBadDump, n+1, reg, v)
+				}
+				frame[reg] = byte(v)
+			}
+			frames = append(frames, frame)
+		case len(frames) == 0:
+			*h = object.dumpHeader
+		default:
+			return nil, fmt.Errorf("%w: line %d: no regs", ErrBadDump, n+1)
+		}
+	}
+	return frames, nil
+}
@@ -0,0 +1,134 @@
+package stsound
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDumpRoundTrip(t *testing.T) {
+	data := seekSong(t)
+	ym := NewYmMusic(44100)
+	if err := ym.LoadMemory(data); err != nil {
+		t.Fatal(err)
+	}
+	song, err := ym.Song()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded, _ := EncodeYM(song); !bytes.Equal(encoded, data) {
+		t.Fatal("Song does not encode back to the loaded file")
+	}
+
+	for _, format := range []DumpFormat{DumpText, DumpCSV, DumpJSONL} {
+		var dump bytes.Buffer
+		if err := DumpSong(&dump, song, format); err != nil {
+			t.Fatal(err)
+		}
+		if format != DumpJSONL && !strings.Contains(dump.String(), "B digidrum #0 30720Hz") {
+			t.Errorf("%s: digidrum of frame 160 not decoded", format)
+		}
+
+		imported, err := ReadDump(&dump)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if encoded, _ := EncodeYM(imported); !bytes.Equal(encoded, data) {
+			t.Errorf("%s: the imported song differs", format)
+		}
+	}
+}
+
+// A YM2 song exported as YM5 plays the same, Mad Max envelopes included
+func TestSongYM2(t *testing.T) {
+	const nbFrame = 100
+	var regs [14][nbFrame]byte
+	for i := 0; i < nbFrame; i++ {
+		regs[0][i], regs[1][i] = byte(i*3), byte(i>>4)
+		regs[7][i] = 0x38
+		regs[8][i], regs[9][i], regs[10][i] = 15, byte(i%16), 0x10
+		regs[11][i], regs[12][i] = byte(40+i), byte(i)
+		regs[13][i] = 0xff
+		if i%10 == 0 {
+			regs[13][i] = byte(i / 10)
+		}
+	}
+	data := []byte("YM2!")
+	for _, r := range regs {
+		data = append(data, r[:]...)
+	}
+
+	render := func(data []byte) []YmSample {
+		ym := NewYmMusic(44100)
+		if err := ym.LoadMemory(data); err != nil {
+			t.Fatal(err)
+		}
+		ym.Play()
+		buffer := make([]YmSample, 44100)
+		ym.Update(buffer, len(buffer))
+		return buffer
+	}
+
+	ym := NewYmMusic(44100)
+	if err := ym.LoadMemory(data); err != nil {
+		t.Fatal(err)
+	}
+	song, err := ym.Song()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if song.Format != YM_V5 || len(song.Frames) != nbFrame {
+		t.Fatalf("YM2 exported as format %d with %d frames", song.Format, len(song.Frames))
+	}
+	if f := song.Frames[10]; f[11] != 50 || f[12] != 0 || f[13] != 10 {
+		t.Errorf("frame 10: envelope %d %d shape %d, want 50 0 shape 10", f[11], f[12], f[13])
+	}
+	encoded, err := EncodeYM(song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(render(encoded), render(data)) {
+		t.Error("the exported YM2 song plays differently")
+	}
+}
+
+func TestReadDumpByHand(t *testing.T) {
+	// Sans en-tête, seule la colonne des registres compte
+	dump := `
+# name: Edited
+0 | whatever | 00 01 02 03 04 05 06 07 08 09 0A 0B 0C FF 00 00
+1 | 10 11 12 13 14 15 16 17 18 19 1A 1B 1C 0D 00 00 | notes
+`
+	song, err := ReadDump(strings.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if song.Format != YM_V6 || song.Clock != ATARI_CLOCK || song.PlayerRate != 50 || song.SongName != "Edited" {
+		t.Errorf("header: %+v", song)
+	}
+	if len(song.Frames) != 2 || song.Frames[0][13] != 0xff || song.Frames[1][0] != 0x10 {
+		t.Errorf("frames: %v", song.Frames)
+	}
+
+	csvDump := "frame,r15,r14,r13,r12,r11,r10,r9,r8,r7,r6,r5,r4,r3,r2,r1,r0\n0,0,0,255,0,0,15,0,0,0x3e,0,0,0,0,0,1,200\n"
+	if song, err = ReadDump(strings.NewReader(csvDump)); err != nil {
+		t.Fatal(err)
+	}
+	if song.Frames[0][0] != 200 || song.Frames[0][7] != 0x3e || song.Frames[0][10] != 15 {
+		t.Errorf("csv frame: %v", song.Frames[0])
+	}
+
+	for _, bad := range []string{
+		"0 | 00 01 02",
+		"# format: YM2\n0 | 00 01 02 03 04 05 06 07 08 09 0A 0B 0C FF 00 00",
+		"# loop: 5\n0 | 00 01 02 03 04 05 06 07 08 09 0A 0B 0C FF 00 00",
+		"frame,r0\n0,1",
+		`{"format":"YM5"}` + "\n" + `{"regs":[1,2]}`,
+	} {
+		if _, err := ReadDump(strings.NewReader(bad)); !errors.Is(err, ErrBadDump) {
+			t.Errorf("ReadDump(%q) = %v, want ErrBadDump", bad, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package stsound
+
+import "math"
+
+// Band-limited resampler used by the accurate core: the chip runs at
+// clock/8 (250kHz on the ST) and is decimated to the replay rate through a
+// windowed-sinc low-pass filter.
+
+const (
+	resamplerZeroCrossings = 8  // Zero crossings on each side of the kernel
+	resamplerKernelRes     = 64 // Kernel table entries per input tick
+	resamplerCutoff        = 0.45
+)
+
+type resampler struct {
+	step      float64 // Input ticks per output sample
+	halfWidth int     // Kernel half width, in input ticks
+	kernel    []float64
+
+	history [][3]float64 // Ring buffer of the last input ticks, newest at histPos
+	histPos int
+	time    float64 // Output instant relative to the newest tick, in ticks
+}
+
+func newResampler(inRate, outRate float64) *resampler {
+	// Coupure sous la moitié de la plus basse des deux fréquences
+	cutoff := resamplerCutoff * math.Min(inRate, outRate) / inRate
+	halfWidth := int(math.Ceil(resamplerZeroCrossings / (2 * cutoff)))
+
+	r := &resampler{
+		step:      inRate / outRate,
+		halfWidth: halfWidth,
+		kernel:    make([]float64, halfWidth*resamplerKernelRes+2),
+		history:   make([][3]float64, 2*halfWidth+2),
+	}
+
+	for i := range r.kernel {
+		x := float64(i) / resamplerKernelRes
+		if x >= float64(halfWidth) {
+			break
+		}
+		sinc := 1.0
+		if x > 0 {
+			sinc = math.Sin(2*math.Pi*cutoff*x) / (2 * math.Pi * cutoff * x)
+		}
+		// Fenêtre de Blackman
+		w := x / float64(halfWidth)
+		r.kernel[i] = sinc * (0.42 + 0.5*math.Cos(math.Pi*w) + 0.08*math.Cos(2*math.Pi*w))
+	}
+	return r
+}
+
+func (r *resampler) reset() {
+	for i := range r.history {
+		r.history[i] = [3]float64{}
+	}
+	r.histPos = 0
+	r.time = 0
+}
+
+// next pulls as many input ticks as needed from tick and returns the
+// filtered value of each voice at the next output instant. The output is
+// delayed by halfWidth ticks so that the kernel only covers past input.
+func (r *resampler) next(tick func() [3]float64) [3]YmInt {
+	r.time += r.step
+	for r.time > 0 {
+		r.histPos++
+		if r.histPos == len(r.history) {
+			r.histPos = 0
+		}
+		r.history[r.histPos] = tick()
+		r.time--
+	}
+
+	// Distance (en ticks) entre l'instant de sortie et le tick le plus récent
+	offset := float64(r.halfWidth) - r.time
+	var sum [3]float64
+	var weights float64
+	for k := 0; k < len(r.history); k++ {
+		x := math.Abs(float64(k) - offset)
+		if x >= float64(r.halfWidth) {
+			continue
+		}
+		pos := x * resamplerKernelRes
+		i := int(pos)
+		frac := pos - float64(i)
+		w := r.kernel[i] + (r.kernel[i+1]-r.kernel[i])*frac
+
+		in := &r.history[(r.histPos-k+len(r.history))%len(r.history)]
+		sum[0] += in[0] * w
+		sum[1] += in[1] * w
+		sum[2] += in[2] * w
+		weights += w
+	}
+
+	var out [3]YmInt
+	for i := range out {
+		out[i] = YmInt(math.Round(sum[i] / weights))
+	}
+	return out
+}
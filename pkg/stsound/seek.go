@@ -0,0 +1,202 @@
+package stsound
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SeekMode selects how SetMusicTime rebuilds the chip state of YM2 to YM6
+// songs, whose registers are only known frame by frame
+type SeekMode int
+
+const (
+	// SeekExact replays the song from the closest keyframe, rendering and
+	// discarding the skipped samples: the state after the seek matches
+	// linear playback bit for bit (default), on both cores. Keyframes are
+	// taken during playback, every 10s on the fast core and every second on
+	// the accurate one, some 30 times slower: a seek back replays about
+	// 15ms, resp. 55ms of computation. The player stays locked meanwhile.
+	SeekExact SeekMode = iota
+	// SeekFast writes the registers of the skipped frames without rendering
+	// them: notes, mixer and envelope shape are right, but generator phases
+	// and filter history are not those of linear playback
+	SeekFast
+)
+
+func (m SeekMode) String() string {
+	switch m {
+	case SeekExact:
+		return "exact"
+	case SeekFast:
+		return "fast"
+	}
+	return "unknown"
+}
+
+// ParseSeekMode accepts "exact" or "fast"
+func ParseSeekMode(s string) (SeekMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "exact":
+		return SeekExact, nil
+	case "fast":
+		return SeekFast, nil
+	}
+	return SeekExact, fmt.Errorf("unknown seek mode %q: expected exact or fast", s)
+}
+
+// outputMode is the Update variant last used: the filters of the stereo and
+// multitrack outputs have their own history, an exact seek renders the
+// skipped frames the same way
+type outputMode int
+
+const (
+	outputMono outputMode = iota
+	outputStereo
+	outputMultitrack
+)
+
+// Une keyframe est prise toutes les keyframeInterval secondes de musique
+// jouées ou parcourues par les seeks exacts, plus souvent sur le core précis
+// pour que le rejeu reste court
+const (
+	keyframeInterval         = 10
+	accurateKeyframeInterval = 1
+)
+
+type keyframe struct {
+	frame    int
+	snapshot []byte
+}
+
+// SetSeekMode selects the exact (default) or the fast seek
+func (ym *CYmMusic) SetSeekMode(mode SeekMode) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.seekMode = mode
+}
+
+// GetSeekMode returns the seek mode in use
+func (ym *CYmMusic) GetSeekMode() SeekMode {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.seekMode
+}
+
+// vblNbSample is the number of samples rendered per frame
+func (ym *CYmMusic) vblNbSample() int {
+	return max(ym.replayRate/int(ym.playerRate), 1)
+}
+
+// keyframeFrames is the number of frames between two keyframes
+func (ym *CYmMusic) keyframeFrames() int64 {
+	interval := keyframeInterval
+	if ym.ymChip.core == CoreAccurate {
+		interval = accurateKeyframeInterval
+	}
+	return int64(interval) * int64(ym.playerRate)
+}
+
+// exactSeek tells whether seeks replay the song
+func (ym *CYmMusic) exactSeek() bool {
+	return ym.seekMode == SeekExact
+}
+
+// seekFrame rebuilds the state of linear playback at the start of frame,
+// counted from the start of the song: past the end, the loops are replayed.
+// Keyframes are snapshots of that state, they are dropped when a setting
+// that changes the rendering is modified.
+func (ym *CYmMusic) seekFrame(frame int) {
+	if ym.keyframesMode != ym.outputMode {
+		ym.keyframes = nil
+		ym.keyframesMode = ym.outputMode
+	}
+
+	// Départ : la dernière keyframe avant frame, sinon le début du morceau
+	ym.ymChip.Reset()
+	ym.currentFrame = 0
+	ym.innerSamplePos = 0
+	ym.playedSamples = 0
+	ym.bMusicOver = YmFalse
+	for i := len(ym.keyframes) - 1; i >= 0; i-- {
+		if ym.keyframes[i].frame <= frame && ym.restore(ym.keyframes[i].snapshot) == nil {
+			break
+		}
+	}
+
+	nbs := ym.vblNbSample()
+	target := int64(frame) * int64(nbs)
+	ym.inexact = !ym.exactSeek()
+	if ym.inexact {
+		for ym.playedSamples < target && !ym.bMusicOver {
+			ym.player()
+			ym.playedSamples += int64(nbs)
+		}
+		return
+	}
+
+	// Les frames sautées sont calculées même en pause, sans être signalées.
+	// update prend les keyframes au passage.
+	paused, subscribers := ym.bPause, ym.subscribers
+	ym.bPause, ym.subscribers = YmFalse, nil
+
+	var buffer []YmSample
+	var tracks [3][]YmSample
+	switch ym.outputMode {
+	case outputStereo:
+		buffer = make([]YmSample, 2*nbs)
+	case outputMultitrack:
+		buffer = make([]YmSample, nbs)
+		for i := range tracks {
+			tracks[i] = make([]YmSample, nbs)
+		}
+	default:
+		buffer = make([]YmSample, nbs)
+	}
+
+	for ym.playedSamples < target && !ym.bMusicOver {
+		switch ym.outputMode {
+		case outputStereo:
+			ym.updateStereo(buffer, nbs)
+		case outputMultitrack:
+			ym.updateMultitrack(tracks, buffer, nbs)
+		default:
+			ym.updateMono(buffer, nbs)
+		}
+	}
+
+	ym.bPause, ym.subscribers = paused, subscribers
+}
+
+// frameKeyframe is called by update at the start of each frame, played
+// being its position in samples: every keyframeFrames frames, the state
+// is saved for the exact seeks. Il faut un état de lecture linéaire, pas
+// celui d'un seek rapide ou d'un Restore.
+func (ym *CYmMusic) frameKeyframe(played int64) {
+	if ym.inexact || !ym.exactSeek() {
+		return
+	}
+	nbs := int64(ym.vblNbSample())
+	if played == 0 || played%(nbs*ym.keyframeFrames()) != 0 {
+		return
+	}
+	if ym.keyframesMode != ym.outputMode {
+		ym.keyframes = nil
+		ym.keyframesMode = ym.outputMode
+	}
+
+	// playedSamples n'est mis à jour qu'à la fin de update
+	saved := ym.playedSamples
+	ym.playedSamples = played
+	ym.addKeyframe(int(played / nbs))
+	ym.playedSamples = saved
+}
+
+func (ym *CYmMusic) addKeyframe(frame int) {
+	i, found := slices.BinarySearchFunc(ym.keyframes, frame, func(k keyframe, frame int) int {
+		return k.frame - frame
+	})
+	if !found {
+		ym.keyframes = slices.Insert(ym.keyframes, i, keyframe{frame, ym.snapshot()})
+	}
+}
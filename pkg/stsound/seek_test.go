@@ -0,0 +1,160 @@
+package stsound
+
+import (
+	"slices"
+	"testing"
+)
+
+// An exact seek must land on the state of linear playback: the samples that
+// follow are identical, for every output
+func TestSeekExact(t *testing.T) {
+	data := seekSong(t)
+	const rate = 44100
+
+	for _, core := range []YmCore{CoreFast, CoreAccurate} {
+		for _, stereo := range []bool{false, true} {
+			channels := 1
+			if stereo {
+				channels = 2
+			}
+			newPlayer := func() *CYmMusic {
+				ym := NewYmMusic(rate)
+				ym.SetCore(core)
+				if err := ym.LoadMemory(data); err != nil {
+					t.Fatal(err)
+				}
+				ym.Play()
+				return ym
+			}
+			render := func(ym *CYmMusic, out []YmSample, chunk int) {
+				for pos := 0; pos < len(out); pos += chunk * channels {
+					n := min(chunk, (len(out)-pos)/channels)
+					if stereo {
+						ym.UpdateStereo(out[pos:], n)
+					} else {
+						ym.Update(out[pos:], n)
+					}
+				}
+			}
+
+			linear := make([]YmSample, 14*rate*channels)
+			render(newPlayer(), linear, 1000)
+
+			ym := newPlayer()
+			render(ym, make([]YmSample, 3000*channels), 3000)
+			// 12s construit une keyframe à 10s, reprise par les seeks suivants
+			for _, ms := range []int{12000, 11000, 3500, 13000, 10000} {
+				ym.SetMusicTime(YmU32(ms))
+				start := ms * rate / 1000 * channels
+				got := make([]YmSample, min(rate/2*channels, len(linear)-start))
+				render(ym, got, 777)
+				if !slices.Equal(got, linear[start:start+len(got)]) {
+					t.Errorf("%s core, %d channels: seek to %dms differs from linear playback", core, channels, ms)
+				}
+			}
+			if len(ym.keyframes) == 0 {
+				t.Errorf("%s core: no keyframe built", core)
+			}
+		}
+	}
+}
+
+// Playback takes the keyframes the exact seeks would take, the state of a
+// fast seek is never saved
+func TestSeekKeyframes(t *testing.T) {
+	data := seekSong(t)
+	newPlayer := func(core YmCore, mode SeekMode) *CYmMusic {
+		ym := NewYmMusic(44100)
+		ym.SetCore(core)
+		ym.SetSeekMode(mode)
+		if err := ym.LoadMemory(data); err != nil {
+			t.Fatal(err)
+		}
+		ym.Play()
+		return ym
+	}
+	buffer := make([]YmSample, 1000)
+	play := func(ym *CYmMusic, ms int) {
+		for n := ms * 44100 / 1000; n > 0; n -= len(buffer) {
+			ym.Update(buffer, min(n, len(buffer)))
+		}
+	}
+
+	played := newPlayer(CoreFast, SeekExact)
+	play(played, 12000)
+	seeked := newPlayer(CoreFast, SeekExact)
+	seeked.SetMusicTime(12000)
+	if len(played.keyframes) != 1 || played.keyframes[0].frame != 500 {
+		t.Fatalf("keyframes after 12s of playback: %v", played.keyframes)
+	}
+	if len(seeked.keyframes) != 1 || !slices.Equal(played.keyframes[0].snapshot, seeked.keyframes[0].snapshot) {
+		t.Error("the keyframe of playback differs from the one of the exact seek")
+	}
+
+	// Après un seek rapide, l'état n'est pas celui de la lecture linéaire
+	ym := newPlayer(CoreFast, SeekFast)
+	ym.SetMusicTime(9000)
+	ym.SetSeekMode(SeekExact)
+	play(ym, 2000)
+	if len(ym.keyframes) != 0 {
+		t.Error("keyframe taken after a fast seek")
+	}
+
+	// Le core précis, plus lent, prend une keyframe par seconde
+	played = newPlayer(CoreAccurate, SeekExact)
+	play(played, 3100)
+	frames := make([]int, len(played.keyframes))
+	for i, k := range played.keyframes {
+		frames[i] = k.frame
+	}
+	if !slices.Equal(frames, []int{50, 100, 150}) {
+		t.Errorf("accurate core: keyframes at frames %v, want 50 100 150", frames)
+	}
+}
+
+// The registers are applied at the start of each frame whatever the buffer size
+func TestRenderChunkSize(t *testing.T) {
+	data := seekSong(t)
+	var want []YmSample
+	for _, chunk := range []int{882, 1, 100, 881, 883, 4096} {
+		ym := NewYmMusic(44100)
+		if err := ym.LoadMemory(data); err != nil {
+			t.Fatal(err)
+		}
+		ym.Play()
+		out := make([]YmSample, 3*44100)
+		for pos := 0; pos < len(out); pos += chunk {
+			ym.Update(out[pos:], min(chunk, len(out)-pos))
+		}
+		if want == nil {
+			want = out
+		} else if !slices.Equal(out, want) {
+			t.Errorf("rendering by %d samples differs", chunk)
+		}
+	}
+}
+
+// A fast seek sets the registers of the target frame
+func TestSeekFast(t *testing.T) {
+	data := seekSong(t)
+	for _, ms := range []int{2000, 9020, 13000} {
+		linear := NewYmMusic(44100)
+		linear.LoadMemory(data)
+		linear.Play()
+		n := ms * 44100 / 1000
+		linear.Update(make([]YmSample, n+1), n+1)
+
+		ym := NewYmMusic(44100)
+		ym.SetSeekMode(SeekFast)
+		ym.LoadMemory(data)
+		ym.Play()
+		ym.SetMusicTime(YmU32(ms))
+		ym.Update(make([]YmSample, 1), 1)
+
+		for reg := YmInt(0); reg < 13; reg++ {
+			if got, want := ym.ymChip.ReadRegister(reg), linear.ymChip.ReadRegister(reg); got != want {
+				t.Errorf("seek to %dms: register %d = %d, want %d", ms, reg, got, want)
+			}
+		}
+	}
+}
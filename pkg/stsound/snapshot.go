@@ -0,0 +1,658 @@
+package stsound
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Snapshots capture the playback state of a chip or a player in a compact
+// binary blob: varints for the counters, raw bytes for the registers and the
+// digidrum being played. Settings (chip and mix model, core, panning, voice
+// control, filter chain) are not part of the state and stay as configured on
+// the instance being restored.
+
+const (
+	chipSnapshotMagic  = "YMC1"
+	musicSnapshotMagic = "YMS1"
+)
+
+type snapshotWriter struct {
+	buf []byte
+}
+
+func (w *snapshotWriter) uint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *snapshotWriter) int(v int64) {
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *snapshotWriter) bool(b YmBool) {
+	if b {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *snapshotWriter) float(f float64) {
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(f))
+}
+
+func (w *snapshotWriter) bytes(b []byte) {
+	w.uint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// snapshotReader garde la première erreur : les lectures suivantes
+// renvoient zéro et l'appelant ne teste err qu'une fois à la fin
+type snapshotReader struct {
+	buf []byte
+	err error
+}
+
+func (r *snapshotReader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: "+format, append([]any{ErrBadSnapshot}, args...)...)
+	}
+}
+
+func (r *snapshotReader) uint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail("truncated")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *snapshotReader) int() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.fail("truncated")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+// u32 reads an unsigned value that must fit in 32 bits
+func (r *snapshotReader) u32() YmU32 {
+	v := r.uint()
+	if v > math.MaxUint32 {
+		r.fail("value %d out of range", v)
+		return 0
+	}
+	return YmU32(v)
+}
+
+// intRange reads a signed value in [min, max]
+func (r *snapshotReader) intRange(min, max int64) int64 {
+	v := r.int()
+	if v < min || v > max {
+		r.fail("value %d out of range [%d, %d]", v, min, max)
+		return min
+	}
+	return v
+}
+
+func (r *snapshotReader) bool() YmBool {
+	if r.err != nil {
+		return YmFalse
+	}
+	if len(r.buf) < 1 || r.buf[0] > 1 {
+		r.fail("bad boolean")
+		return YmFalse
+	}
+	b := r.buf[0] == 1
+	r.buf = r.buf[1:]
+	return YmBool(b)
+}
+
+func (r *snapshotReader) float() float64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) < 8 {
+		r.fail("truncated")
+		return 0
+	}
+	f := math.Float64frombits(binary.LittleEndian.Uint64(r.buf))
+	r.buf = r.buf[8:]
+	return f
+}
+
+func (r *snapshotReader) bytes() []byte {
+	n := r.uint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.fail("truncated")
+		return nil
+	}
+	b := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *snapshotReader) magic(magic string) {
+	if len(r.buf) < len(magic) || string(r.buf[:len(magic)]) != magic {
+		r.fail("expected %s header", magic)
+		return
+	}
+	r.buf = r.buf[len(magic):]
+}
+
+// done checks that the whole snapshot has been read
+func (r *snapshotReader) done() error {
+	if r.err == nil && len(r.buf) != 0 {
+		r.fail("%d trailing bytes", len(r.buf))
+	}
+	return r.err
+}
+
+// Snapshot returns the playback state of the chip: registers, generator
+// positions, special effects, filter history and accurate core counters
+func (ym *CYm2149Ex) Snapshot() []byte {
+	w := &snapshotWriter{buf: []byte(chipSnapshotMagic)}
+
+	for _, v := range ym.registers {
+		w.buf = append(w.buf, byte(v))
+	}
+	for _, v := range []YmU32{
+		ym.stepA, ym.stepB, ym.stepC,
+		ym.posA, ym.posB, ym.posC,
+		ym.mixerTA, ym.mixerTB, ym.mixerTC,
+		ym.mixerNA, ym.mixerNB, ym.mixerNC,
+		ym.noiseStep, ym.noisePos, ym.rndRack, ym.currentNoise,
+		ym.envStep, ym.envPos,
+	} {
+		w.uint(uint64(v))
+	}
+	for _, v := range []YmInt{ym.volA, ym.volB, ym.volC, ym.volE, ym.envPhase, ym.envShape} {
+		w.int(int64(v))
+	}
+	// Les pointeurs de volume ne sont que "enveloppe ou volume fixe"
+	w.bool(ym.pVolA == &ym.volE)
+	w.bool(ym.pVolB == &ym.volE)
+	w.bool(ym.pVolC == &ym.volE)
+
+	for i := range ym.specialEffect {
+		e := &ym.specialEffect[i]
+		w.bool(e.Drum)
+		if e.Drum {
+			data := make([]byte, len(e.DrumData))
+			for i, v := range e.DrumData {
+				data[i] = byte(v)
+			}
+			w.bytes(data)
+			w.uint(uint64(e.DrumSize))
+			w.uint(uint64(e.DrumPos))
+			w.uint(uint64(e.DrumStep))
+		}
+		w.bool(e.Sid)
+		w.bool(e.SidSin)
+		w.uint(uint64(e.SidPos))
+		w.uint(uint64(e.SidStep))
+		w.int(int64(e.SidVol))
+	}
+	w.bool(ym.bSyncBuzzer)
+	w.uint(uint64(ym.syncBuzzerStep))
+	w.uint(uint64(ym.syncBuzzerPhase))
+
+	for _, chain := range ym.filterChains() {
+		snapshotFilterChain(w, ym.filterStages, chain)
+	}
+
+	a := &ym.accurate
+	for voice := 0; voice < 3; voice++ {
+		w.int(int64(a.toneCounter[voice]))
+		w.int(int64(a.toneOut[voice]))
+	}
+	w.int(int64(a.noiseCounter))
+	w.uint(uint64(a.noiseRng))
+	w.int(int64(a.envCounter))
+	w.int(int64(a.envPos))
+	w.bool(a.resampler != nil)
+	if a.resampler != nil {
+		w.uint(uint64(len(a.resampler.history)))
+		for _, h := range a.resampler.history {
+			w.float(h[0])
+			w.float(h[1])
+			w.float(h[2])
+		}
+		w.int(int64(a.resampler.histPos))
+		w.float(a.resampler.time)
+	}
+	return w.buf
+}
+
+// Restore sets the playback state saved by Snapshot. On error the chip is
+// left unchanged.
+func (ym *CYm2149Ex) Restore(data []byte) error {
+	backup := ym.Snapshot()
+	if err := ym.restore(data); err != nil {
+		ym.restore(backup)
+		return err
+	}
+	return nil
+}
+
+func (ym *CYm2149Ex) restore(data []byte) error {
+	r := &snapshotReader{buf: data}
+	r.magic(chipSnapshotMagic)
+
+	if r.err == nil && len(r.buf) < len(ym.registers) {
+		r.fail("truncated")
+	}
+	if r.err != nil {
+		return r.err
+	}
+	for i := range ym.registers {
+		ym.registers[i] = YmU8(r.buf[i])
+	}
+	r.buf = r.buf[len(ym.registers):]
+
+	for _, p := range []*YmU32{
+		&ym.stepA, &ym.stepB, &ym.stepC,
+		&ym.posA, &ym.posB, &ym.posC,
+		&ym.mixerTA, &ym.mixerTB, &ym.mixerTC,
+		&ym.mixerNA, &ym.mixerNB, &ym.mixerNC,
+		&ym.noiseStep, &ym.noisePos, &ym.rndRack, &ym.currentNoise,
+		&ym.envStep, &ym.envPos,
+	} {
+		*p = r.u32()
+	}
+	for _, p := range []*YmInt{&ym.volA, &ym.volB, &ym.volC, &ym.volE} {
+		*p = YmInt(r.intRange(math.MinInt32, math.MaxInt32))
+	}
+	ym.envPhase = YmInt(r.intRange(0, 1))
+	ym.envShape = YmInt(r.intRange(0, 15))
+
+	pVol := []struct {
+		p   **YmInt
+		own *YmInt
+	}{{&ym.pVolA, &ym.volA}, {&ym.pVolB, &ym.volB}, {&ym.pVolC, &ym.volC}}
+	for _, v := range pVol {
+		if r.bool() {
+			*v.p = &ym.volE
+		} else {
+			*v.p = v.own
+		}
+	}
+
+	for i := range ym.specialEffect {
+		e := YmSpecialEffect{}
+		e.Drum = r.bool()
+		if e.Drum {
+			// Copie : le blob appartient à l'appelant
+			data := r.bytes()
+			e.DrumData = make([]YmU8, len(data))
+			for i, v := range data {
+				e.DrumData[i] = YmU8(v)
+			}
+			e.DrumSize = r.u32()
+			e.DrumPos = r.u32()
+			e.DrumStep = r.u32()
+			if e.DrumSize == 0 || e.DrumSize > YmU32(len(e.DrumData)) || e.DrumPos>>DRUM_PREC >= e.DrumSize {
+				r.fail("digidrum position %d/%d for %d bytes", e.DrumPos>>DRUM_PREC, e.DrumSize, len(e.DrumData))
+			}
+		}
+		e.Sid = r.bool()
+		e.SidSin = r.bool()
+		e.SidPos = r.u32()
+		e.SidStep = r.u32()
+		e.SidVol = YmInt(r.intRange(0, 15))
+		ym.specialEffect[i] = e
+		ym.sidSinStopped[i] = YmFalse
+	}
+	ym.bSyncBuzzer = r.bool()
+	ym.syncBuzzerStep = r.u32()
+	ym.syncBuzzerPhase = r.u32()
+
+	for _, chain := range ym.filterChains() {
+		restoreFilterChain(r, ym.filterStages, chain)
+	}
+
+	a := &ym.accurate
+	for voice := 0; voice < 3; voice++ {
+		a.toneCounter[voice] = int(r.intRange(0, math.MaxInt32))
+		a.toneOut[voice] = YmU32(r.intRange(0, 1))
+	}
+	a.noiseCounter = int(r.intRange(0, math.MaxInt32))
+	a.noiseRng = r.u32() & 0x1ffff
+	a.envCounter = int(r.intRange(0, math.MaxInt32))
+	a.envPos = int(r.intRange(0, 63))
+	if r.bool() {
+		if a.resampler == nil {
+			a.resampler = newResampler(float64(ym.internalClock)/8, float64(ym.replayFrequency))
+		}
+		// Chaque point prend 24 octets : la taille est vérifiée avant l'allocation
+		n := r.uint()
+		if r.err == nil && n > uint64(len(r.buf)/24) {
+			r.fail("truncated")
+		}
+		if r.err == nil && n > uint64(len(a.resampler.history)) {
+			r.fail("resampler history of %d points, want at most %d", n, len(a.resampler.history))
+		}
+		if r.err != nil {
+			return r.err
+		}
+		history := make([][3]float64, n)
+		for i := range history {
+			history[i] = [3]float64{r.float(), r.float(), r.float()}
+		}
+		histPos := int(r.intRange(0, int64(max(len(history)-1, 0))))
+		time := r.float()
+		// Un historique d'une autre taille vient d'une autre horloge : on repart de zéro
+		if len(history) == len(a.resampler.history) {
+			copy(a.resampler.history, history)
+			a.resampler.histPos = histPos
+			a.resampler.time = time
+		} else {
+			a.resampler.reset()
+		}
+	} else if a.resampler != nil {
+		a.resampler.reset()
+	}
+
+	return r.done()
+}
+
+// filterChains lists the chains in the order they are saved
+func (ym *CYm2149Ex) filterChains() []FilterChain {
+	return []FilterChain{ym.filters, ym.filtersR, ym.trackFilters[0], ym.trackFilters[1], ym.trackFilters[2]}
+}
+
+// snapshotFilterChain saves the name and the state of each stage. Filters
+// that do not implement encoding.BinaryMarshaler are saved without state.
+func snapshotFilterChain(w *snapshotWriter, stages []FilterStage, chain FilterChain) {
+	w.uint(uint64(len(chain)))
+	for i, f := range chain {
+		w.bytes([]byte(stages[i].Name))
+		var state []byte
+		if m, ok := f.(encoding.BinaryMarshaler); ok {
+			state, _ = m.MarshalBinary()
+		}
+		w.bytes(state)
+	}
+}
+
+// restoreFilterChain restores the stages found at the same position with
+// the same name, the others start from a clean state
+func restoreFilterChain(r *snapshotReader, stages []FilterStage, chain FilterChain) {
+	n := r.uint()
+	if r.err == nil && n > uint64(len(r.buf)) {
+		r.fail("truncated")
+	}
+	restored := make([]bool, len(chain))
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		name := string(r.bytes())
+		state := r.bytes()
+		if i >= uint64(len(chain)) || stages[i].Name != name || r.err != nil {
+			continue
+		}
+		if u, ok := chain[i].(encoding.BinaryUnmarshaler); ok && len(state) > 0 {
+			if err := u.UnmarshalBinary(state); err != nil {
+				r.fail("filter %s: %v", name, err)
+				return
+			}
+			restored[i] = true
+		}
+	}
+	for i, f := range chain {
+		if !restored[i] {
+			f.Reset()
+		}
+	}
+}
+
+// Snapshot returns the playback state of the song: current frame, mix and
+// tracker positions, and the state of the chip. Restore only accepts it on
+// the same song.
+func (ym *CYmMusic) Snapshot() []byte {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.snapshot()
+}
+
+// Restore sets the playback state saved by Snapshot. It fails with
+// ErrSnapshotMismatch if the snapshot was taken on another song, and leaves
+// the player unchanged on error.
+func (ym *CYmMusic) Restore(data []byte) error {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	err := ym.restore(data)
+	if err == nil {
+		// L'origine de l'état est inconnue : pas de keyframe avant le prochain seek exact
+		ym.inexact = true
+	}
+	return err
+}
+
+func (ym *CYmMusic) snapshot() []byte {
+	w := &snapshotWriter{buf: []byte(musicSnapshotMagic)}
+	w.uint(uint64(ym.songCRC))
+	w.int(int64(ym.songType))
+	w.int(int64(ym.nbFrame))
+
+	w.int(int64(ym.currentFrame))
+	w.int(int64(ym.innerSamplePos))
+	w.int(ym.playedSamples)
+	w.bool(ym.bMusicOver)
+
+	w.int(int64(ym.mixPos))
+	w.int(int64(ym.nbRepeat))
+	for _, v := range []YmU32{
+		ym.currentPos, ym.currentSampleLength, ym.currentPente,
+		ym.iMusicPosAccurateSample, ym.iMusicPosInMs,
+	} {
+		w.uint(uint64(v))
+	}
+
+	w.int(int64(ym.ymTrackerNbSampleBefore))
+	for i := 0; i < ym.nbVoice; i++ {
+		v := &ym.ymTrackerVoice[i]
+		// Le sample est repéré par son numéro de digidrum
+		w.int(int64(ym.trackerSampleIndex(v.Sample)))
+		w.uint(uint64(v.SamplePos))
+		w.int(int64(v.SampleVolume))
+		w.uint(uint64(v.SampleFreq))
+		w.bool(v.Loop)
+		w.bool(v.Running)
+	}
+
+	w.bytes(ym.ymChip.Snapshot())
+	return w.buf
+}
+
+func (ym *CYmMusic) restore(data []byte) error {
+	if !ym.bMusicOk {
+		return fmt.Errorf("%w: no song loaded", ErrSnapshotMismatch)
+	}
+
+	r := &snapshotReader{buf: data}
+	r.magic(musicSnapshotMagic)
+	crc := r.uint()
+	songType := r.int()
+	nbFrame := r.int()
+	if r.err != nil {
+		return r.err
+	}
+	if crc != uint64(ym.songCRC) || songType != int64(ym.songType) || nbFrame != int64(ym.nbFrame) {
+		return fmt.Errorf("%w: snapshot of another song", ErrSnapshotMismatch)
+	}
+
+	currentFrame := int(r.intRange(0, int64(ym.nbFrame)))
+	innerSamplePos := int(r.intRange(0, math.MaxInt32))
+	playedSamples := r.intRange(0, math.MaxInt64)
+	bMusicOver := r.bool()
+
+	mixPos := int(r.intRange(-1, int64(ym.nbMixBlock-1)))
+	nbRepeat := int(r.intRange(-1, math.MaxInt32))
+	var mix [5]YmU32
+	for i := range mix {
+		mix[i] = r.u32()
+	}
+
+	nbSampleBefore := int(r.intRange(0, math.MaxInt32))
+	var voices [MAX_VOICE]YmTrackerVoice
+	for i := 0; i < ym.nbVoice; i++ {
+		v := &voices[i]
+		if drum := int(r.intRange(-1, int64(ym.nbDrum-1))); drum >= 0 {
+			v.Sample = ym.pDrumTab[drum].Data
+			v.SampleSize = ym.pDrumTab[drum].Size
+			v.RepLen = ym.pDrumTab[drum].RepLen
+		}
+		v.SamplePos = r.u32()
+		v.SampleVolume = YmS32(r.intRange(0, 63))
+		v.SampleFreq = r.u32()
+		v.Loop = r.bool()
+		v.Running = r.bool()
+		if v.Running && v.Sample == nil {
+			r.fail("tracker voice %d plays no sample", i)
+		}
+	}
+
+	// La position du mix doit rester dans le bloc courant et dans les samples
+	if mixPos >= 0 && r.err == nil {
+		block := ym.pMixBlock[mixPos]
+		switch {
+		case uint64(block.SampleStart)+uint64(block.SampleLength) > uint64(len(ym.pBigSampleBuffer)):
+			r.fail("mix block %d outside the samples", mixPos)
+		case mix[1]>>12 > block.SampleLength:
+			r.fail("mix sample length %d beyond block %d", mix[1]>>12, mixPos)
+		case mix[0] >= mix[1]:
+			r.fail("mix position %d beyond the sample length %d", mix[0], mix[1])
+		}
+	}
+
+	chip := r.bytes()
+	if err := r.done(); err != nil {
+		return err
+	}
+	if err := ym.ymChip.Restore(chip); err != nil {
+		return err
+	}
+
+	ym.currentFrame = currentFrame
+	ym.innerSamplePos = innerSamplePos
+	ym.playedSamples = playedSamples
+	ym.bMusicOver = bMusicOver
+	ym.drumEffects = [3]int{}
+	ym.mixPos = mixPos
+	ym.nbRepeat = nbRepeat
+	ym.currentPos, ym.currentSampleLength, ym.currentPente = mix[0], mix[1], mix[2]
+	ym.iMusicPosAccurateSample, ym.iMusicPosInMs = mix[3], mix[4]
+	ym.pCurrentMixSample = nil
+	if mixPos >= 0 && ym.pMixBlock != nil {
+		ym.pCurrentMixSample = ym.pBigSampleBuffer[ym.pMixBlock[mixPos].SampleStart:]
+	}
+	ym.ymTrackerNbSampleBefore = nbSampleBefore
+	copy(ym.ymTrackerVoice[:], voices[:])
+	return nil
+}
+
+// trackerSampleIndex returns the digidrum a tracker voice is playing, -1 if none
+func (ym *CYmMusic) trackerSampleIndex(sample []YmU8) int {
+	if len(sample) == 0 {
+		return -1
+	}
+	for i := range ym.pDrumTab[:ym.nbDrum] {
+		if d := ym.pDrumTab[i].Data; len(d) > 0 && &d[0] == &sample[0] {
+			return i
+		}
+	}
+	return -1
+}
+
+// Filter states, for the snapshots
+
+func (d *DcAdjuster) MarshalBinary() ([]byte, error) {
+	w := &snapshotWriter{}
+	w.int(int64(d.pos))
+	w.int(int64(d.sum))
+	for _, v := range d.buffer {
+		w.int(int64(v))
+	}
+	return w.buf, nil
+}
+
+func (d *DcAdjuster) UnmarshalBinary(data []byte) error {
+	r := &snapshotReader{buf: data}
+	pos := int(r.intRange(0, DC_ADJUST_BUFFERLEN-1))
+	sum := YmInt(r.intRange(math.MinInt32, math.MaxInt32))
+	var buffer [DC_ADJUST_BUFFERLEN]YmInt
+	for i := range buffer {
+		buffer[i] = YmInt(r.intRange(math.MinInt32, math.MaxInt32))
+	}
+	if err := r.done(); err != nil {
+		return err
+	}
+	d.buffer, d.pos, d.sum = buffer, pos, sum
+	return nil
+}
+
+func (f *threeTapFilter) MarshalBinary() ([]byte, error) {
+	w := &snapshotWriter{}
+	w.int(int64(f.state[0]))
+	w.int(int64(f.state[1]))
+	return w.buf, nil
+}
+
+func (f *threeTapFilter) UnmarshalBinary(data []byte) error {
+	r := &snapshotReader{buf: data}
+	state := [2]int{int(r.int()), int(r.int())}
+	if err := r.done(); err != nil {
+		return err
+	}
+	f.state = state
+	return nil
+}
+
+func (f *Biquad) MarshalBinary() ([]byte, error) {
+	w := &snapshotWriter{}
+	for _, v := range []float64{f.x1, f.x2, f.y1, f.y2} {
+		w.float(v)
+	}
+	return w.buf, nil
+}
+
+func (f *Biquad) UnmarshalBinary(data []byte) error {
+	r := &snapshotReader{buf: data}
+	x1, x2, y1, y2 := r.float(), r.float(), r.float(), r.float()
+	if err := r.done(); err != nil {
+		return err
+	}
+	f.x1, f.x2, f.y1, f.y2 = x1, x2, y1, y2
+	return nil
+}
+
+func (f *rcFilter) MarshalBinary() ([]byte, error) {
+	w := &snapshotWriter{}
+	for _, v := range []float64{f.low, f.high, f.lastLow} {
+		w.float(v)
+	}
+	return w.buf, nil
+}
+
+func (f *rcFilter) UnmarshalBinary(data []byte) error {
+	r := &snapshotReader{buf: data}
+	low, high, lastLow := r.float(), r.float(), r.float()
+	if err := r.done(); err != nil {
+		return err
+	}
+	f.low, f.high, f.lastLow = low, high, lastLow
+	return nil
+}
@@ -0,0 +1,130 @@
+package stsound
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// A restored player must render exactly what the original rendered after
+// the snapshot, on the same instance and on a fresh one
+func TestSnapshotRestore(t *testing.T) {
+	stages, err := ParseFilterChain("dc,st,lowpass:6000,highpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, seed := range fuzzSeeds(t) {
+		for _, core := range []YmCore{CoreFast, CoreAccurate} {
+			newPlayer := func() *CYmMusic {
+				ym := NewYmMusic(44100)
+				ym.SetCore(core)
+				ym.SetPanning(StereoABC.Pans())
+				ym.SetFilterChain(stages)
+				if err := ym.LoadMemory(seed); err != nil {
+					t.Fatalf("seed %d: %v", i, err)
+				}
+				ym.SetLoopMode(YmTrue)
+				ym.Play()
+				return ym
+			}
+			render := func(ym *CYmMusic) []YmSample {
+				out := make([]YmSample, 2*4096)
+				for pos := 0; pos < len(out); pos += 2 * 512 {
+					ym.UpdateStereo(out[pos:], 512)
+				}
+				return out
+			}
+
+			ym := newPlayer()
+			// Un nombre d'échantillons quelconque, pour que le filtre DC ne
+			// soit pas revenu au début de son buffer
+			ym.UpdateStereo(make([]YmSample, 2*5001), 5001)
+			snapshot := ym.Snapshot()
+			want := render(ym)
+
+			if err := ym.Restore(snapshot); err != nil {
+				t.Fatalf("seed %d, %s core: %v", i, core, err)
+			}
+			if got := render(ym); !slices.Equal(got, want) {
+				t.Errorf("seed %d, %s core: output differs after Restore", i, core)
+			}
+
+			fresh := newPlayer()
+			if err := fresh.Restore(snapshot); err != nil {
+				t.Fatalf("seed %d, %s core: %v", i, core, err)
+			}
+			if got := render(fresh); !slices.Equal(got, want) {
+				t.Errorf("seed %d, %s core: output differs after Restore on a new player", i, core)
+			}
+		}
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	seeds := fuzzSeeds(t)
+	ym := NewYmMusic(44100)
+	if err := ym.LoadMemory(seeds[0]); err != nil {
+		t.Fatal(err)
+	}
+	ym.Play()
+	ym.UpdateStereo(make([]YmSample, 2*1000), 1000)
+	snapshot := ym.Snapshot()
+
+	other := NewYmMusic(44100)
+	if err := other.LoadMemory(seeds[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Restore(snapshot); !errors.Is(err, ErrSnapshotMismatch) {
+		t.Errorf("Restore on another song: got %v, want ErrSnapshotMismatch", err)
+	}
+}
+
+// Truncated and corrupted snapshots give an error, never a panic, on every
+// kind of song and on both cores
+func TestSnapshotCorrupt(t *testing.T) {
+	// Sans le filtre DC et son buffer, les snapshots restent courts
+	stages, err := ParseFilterChain("st,lowpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds := fuzzSeeds(t)
+	// Les vrais fichiers n'ajoutent pas de cas : seuls les seeds construits sont corrompus
+	for i, seed := range seeds[:min(len(seeds), 9)] {
+		for _, core := range []YmCore{CoreFast, CoreAccurate} {
+			ym := NewYmMusic(44100)
+			ym.SetCore(core)
+			ym.SetFilterChain(stages)
+			if err := ym.LoadMemory(seed); err != nil {
+				t.Fatalf("seed %d: %v", i, err)
+			}
+			ym.SetLoopMode(YmTrue)
+			ym.Play()
+			buffer := make([]YmSample, 2*1000)
+			ym.UpdateStereo(buffer, 1000)
+			snapshot := ym.Snapshot()
+
+			for n := 0; n < len(snapshot); n++ {
+				if err := ym.Restore(snapshot[:n]); !errors.Is(err, ErrBadSnapshot) {
+					t.Fatalf("seed %d, %s core: Restore of %d/%d bytes: got %v, want ErrBadSnapshot",
+						i, core, n, len(snapshot), err)
+				}
+			}
+
+			// Un bit inversé par octet, puis l'octet entier : ce qui passe doit se jouer
+			for n := 0; n < len(snapshot); n++ {
+				for _, flip := range []byte{1 << (n % 8), 0xff} {
+					corrupt := slices.Clone(snapshot)
+					corrupt[n] ^= flip
+					if ym.Restore(corrupt) == nil {
+						ym.UpdateStereo(buffer, 64)
+					}
+				}
+			}
+
+			if err := ym.Restore(snapshot); err != nil {
+				t.Fatalf("seed %d, %s core: %v", i, core, err)
+			}
+		}
+	}
+}
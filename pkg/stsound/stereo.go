@@ -0,0 +1,102 @@
+package stsound
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StereoMode selects how the three voices are placed in the stereo field
+type StereoMode int
+
+const (
+	StereoMono StereoMode = iota
+	StereoABC
+	StereoACB
+	StereoBAC
+	StereoCustom
+)
+
+// Pan positions used by the presets: 0 is full left, 1 full right.
+// Les voies ne sont pas complètement séparées, c'est plus agréable au casque.
+const (
+	PanLeft   = 0.2
+	PanCenter = 0.5
+	PanRight  = 0.8
+)
+
+var stereoModeNames = []string{"mono", "abc", "acb", "bac", "custom"}
+
+func (m StereoMode) String() string {
+	if m >= 0 && int(m) < len(stereoModeNames) {
+		return stereoModeNames[m]
+	}
+	return "unknown"
+}
+
+// Pans returns the A, B and C pan positions of a preset.
+// StereoCustom has no fixed positions and returns the mono ones.
+func (m StereoMode) Pans() [3]float64 {
+	switch m {
+	case StereoABC:
+		return [3]float64{PanLeft, PanCenter, PanRight}
+	case StereoACB:
+		return [3]float64{PanLeft, PanRight, PanCenter}
+	case StereoBAC:
+		return [3]float64{PanCenter, PanLeft, PanRight}
+	}
+	return [3]float64{PanCenter, PanCenter, PanCenter}
+}
+
+// ParsePanning reads a preset name (mono, abc, acb, bac) or three custom
+// pan positions separated by commas, such as "0.1,0.5,0.9"
+func ParsePanning(s string) (StereoMode, [3]float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range stereoModeNames[:StereoCustom] {
+		if s == name {
+			return StereoMode(i), StereoMode(i).Pans(), nil
+		}
+	}
+
+	var pans [3]float64
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 {
+		return StereoMono, pans, fmt.Errorf("invalid panning %q: expected mono, abc, acb, bac or three positions", s)
+	}
+	for i, field := range fields {
+		pan, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || pan < 0 || pan > 1 {
+			return StereoMono, pans, fmt.Errorf("invalid pan position %q: expected a value between 0 and 1", field)
+		}
+		pans[i] = pan
+	}
+	return StereoCustom, pans, nil
+}
+
+// panGains converts a pan position into left and right gains (1/256 units).
+// Au centre les deux gains valent 1 : le rendu mono est inchangé.
+func panGains(pan float64) [2]YmInt {
+	if pan < 0 {
+		pan = 0
+	} else if pan > 1 {
+		pan = 1
+	}
+	left := 2 * (1 - pan)
+	right := 2 * pan
+	if left > 1 {
+		left = 1
+	}
+	if right > 1 {
+		right = 1
+	}
+	return [2]YmInt{YmInt(left*256 + 0.5), YmInt(right*256 + 0.5)}
+}
+
+// monoToStereo duplicates the first nbSample samples of pBuffer into
+// interleaved left/right pairs, in place
+func monoToStereo(pBuffer []YmSample, nbSample int) {
+	for i := nbSample - 1; i >= 0; i-- {
+		pBuffer[2*i+1] = pBuffer[i]
+		pBuffer[2*i] = pBuffer[i]
+	}
+}
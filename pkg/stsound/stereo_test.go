@@ -0,0 +1,40 @@
+package stsound
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPanning(t *testing.T) {
+	// Gauche, centre et droite des préréglages, en niveaux gauche/droite
+	levels := map[float64][2]float64{
+		PanLeft:   {1, 0.4},
+		PanCenter: {1, 1},
+		PanRight:  {0.4, 1},
+		0:         {1, 0},
+		1:         {0, 1},
+	}
+	songs := [3][]byte{voiceSong(t, 0), voiceSong(t, 1), voiceSong(t, 2)}
+	full, _ := stereoLevels(t, songs[0], StereoMono.Pans())
+
+	for _, panning := range []string{"mono", "abc", "acb", "bac", "1, 0.5, 0"} {
+		mode, pans, err := ParsePanning(panning)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for voice, pan := range pans {
+			left, right := stereoLevels(t, songs[voice], pans)
+			want := levels[pan]
+			if math.Abs(left/full-want[0]) > 0.02 || math.Abs(right/full-want[1]) > 0.02 {
+				t.Errorf("%s: voice %c at %.2f/%.2f, want %.2f/%.2f",
+					mode, 'A'+voice, left/full, right/full, want[0], want[1])
+			}
+		}
+	}
+
+	for _, bad := range []string{"", "abcd", "0.1,0.5", "0,0.5,1.5", "0,x,1"} {
+		if _, _, err := ParsePanning(bad); err == nil {
+			t.Errorf("ParsePanning(%q) succeeded", bad)
+		}
+	}
+}
@@ -1,6 +1,14 @@
 package stsound
 
-// StSound - Main API interface matching the C API
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// StSound - Main API interface matching the C API. Its methods may be called
+// from several goroutines, except Destroy which must be the last call.
 type StSound struct {
 	music *CYmMusic
 }
@@ -37,6 +45,16 @@ func (s *StSound) LoadMemory(data []byte) error {
 	return s.music.LoadMemory(data)
 }
 
+// LoadReader loads a YM file from a stream (read until EOF)
+func (s *StSound) LoadReader(r io.Reader) error {
+	return s.music.LoadReader(r)
+}
+
+// LoadFS loads a YM file from a file system such as embed.FS
+func (s *StSound) LoadFS(fsys fs.FS, name string) error {
+	return s.music.LoadFS(fsys, name)
+}
+
 // Compute renders audio samples
 func (s *StSound) Compute(buffer []int16, nbSamples int) bool {
 	// Créer un buffer temporaire pour les échantillons YM
@@ -51,21 +69,137 @@ func (s *StSound) Compute(buffer []int16, nbSamples int) bool {
 	return result
 }
 
+// ComputeStereo renders nbSamples interleaved left/right pairs,
+// buffer must hold 2*nbSamples values
+func (s *StSound) ComputeStereo(buffer []int16, nbSamples int) bool {
+	ymBuffer := make([]YmSample, 2*nbSamples)
+	result := s.music.UpdateStereo(ymBuffer, nbSamples) == YmTrue
+
+	for i := range ymBuffer {
+		buffer[i] = int16(ymBuffer[i])
+	}
+
+	return result
+}
+
+// ComputeMultitrack renders each voice into its own buffer (A, B, C) and the
+// mono mix into mix, which may be nil. The three tracks sum to the mix,
+// rounding aside.
+func (s *StSound) ComputeMultitrack(tracks [3][]int16, mix []int16, nbSamples int) bool {
+	var ymTracks [3][]YmSample
+	for i := range ymTracks {
+		ymTracks[i] = make([]YmSample, nbSamples)
+	}
+	ymMix := make([]YmSample, nbSamples)
+	result := s.music.UpdateMultitrack(ymTracks, ymMix, nbSamples) == YmTrue
+
+	for i := 0; i < nbSamples; i++ {
+		for voice := range tracks {
+			tracks[voice][i] = int16(ymTracks[voice][i])
+		}
+		if mix != nil {
+			mix[i] = int16(ymMix[i])
+		}
+	}
+
+	return result
+}
+
+// SetStereoMode selects a panning preset for ComputeStereo (ABC by default)
+func (s *StSound) SetStereoMode(mode StereoMode) {
+	s.music.SetPanning(mode.Pans())
+}
+
+// SetPanning sets custom pan positions for voices A, B and C (0 left, 1 right)
+func (s *StSound) SetPanning(pans [3]float64) {
+	s.music.SetPanning(pans)
+}
+
+// SetCore selects the emulation core: CoreFast (default) or CoreAccurate,
+// slower but free of aliasing, for reference renders
+func (s *StSound) SetCore(core YmCore) {
+	s.music.SetCore(core)
+}
+
+// SetChipModel selects the chip variant: ChipYM2149 (Atari ST, default) or
+// ChipAY8910 (Amstrad CPC, ZX Spectrum)
+func (s *StSound) SetChipModel(model ChipModel) {
+	s.music.SetChipModel(model)
+}
+
+// SetMachine forces a machine profile over the file header, nil to go back to
+// the header clock and player rate. See FindMachine and MachineProfiles.
+func (s *StSound) SetMachine(m *Machine) {
+	s.music.SetMachine(m)
+}
+
+// SetMixModel selects how the voices are summed: MixLinear (default) or
+// MixMeasured, read from the table measured on a real chip given to
+// SetMixTable
+func (s *StSound) SetMixModel(model MixModel) {
+	s.music.SetMixModel(model)
+}
+
+// SetMixTable sets the measured table of MixMeasured, see ParseMixTable
+func (s *StSound) SetMixTable(table *MixTable) {
+	s.music.SetMixTable(table)
+}
+
+// MuteVoice silences voice 0, 1 or 2 (VOICE_A, VOICE_B, VOICE_C),
+// including the digidrums and SID effects it plays
+func (s *StSound) MuteVoice(voice int, mute bool) {
+	s.music.SetVoiceMute(voice, YmBool(mute))
+}
+
+// SoloVoice keeps only the soloed voices audible, even muted ones
+func (s *StSound) SoloVoice(voice int, solo bool) {
+	s.music.SetVoiceSolo(voice, YmBool(solo))
+}
+
+// SetVoiceVolume scales one voice (0 to 2, 1 is the original level)
+func (s *StSound) SetVoiceVolume(voice int, volume float64) {
+	s.music.SetVoiceVolume(voice, volume)
+}
+
 // SetLoopMode enables/disables loop mode
 func (s *StSound) SetLoopMode(loop bool) {
 	s.music.SetLoopMode(YmBool(loop))
 }
 
+// SetLoopPolicy plays the song policy.Loops times, then fades it out.
+// GetInfo and GetPos then cover the whole rendering.
+func (s *StSound) SetLoopPolicy(policy LoopPolicy) {
+	s.music.SetLoopPolicy(policy)
+}
+
 // GetLastError returns the last error message
 func (s *StSound) GetLastError() string {
 	return s.music.GetLastError()
 }
 
+// LastError returns the error of the last load (see ErrTruncated and co.)
+func (s *StSound) LastError() error {
+	return s.music.LastError()
+}
+
 // GetRegister reads a YM register value
 func (s *StSound) GetRegister(reg int) int {
 	return s.music.ReadYmRegister(reg)
 }
 
+// SubscribeFrames calls fn for each frame of a YM2 to YM6 song, from the
+// Compute call that renders it, see FrameEvent. fn must not call the player.
+// The returned function cancels the subscription.
+func (s *StSound) SubscribeFrames(fn func(FrameEvent)) (cancel func()) {
+	return s.music.SubscribeFrames(fn)
+}
+
+// Song returns the register frames of a YM2 to YM6 song, see DumpSong and
+// EncodeYM
+func (s *StSound) Song() (*YmSong, error) {
+	return s.music.Song()
+}
+
 // GetInfo returns music information
 func (s *StSound) GetInfo() *YmMusicInfo {
 	return s.music.GetMusicInfo()
@@ -106,12 +240,51 @@ func (s *StSound) Seek(timeInMs uint32) {
 	s.music.SetMusicTime(YmU32(timeInMs))
 }
 
+// SetSeekMode selects the exact (default) or the fast seek, see SeekMode
+func (s *StSound) SetSeekMode(mode SeekMode) {
+	s.music.SetSeekMode(mode)
+}
+
 // Restart restarts the music from the beginning
 func (s *StSound) Restart() {
 	s.music.Restart()
 }
 
+// Snapshot saves the playback state in a binary blob, see CYmMusic.Snapshot
+func (s *StSound) Snapshot() []byte {
+	return s.music.Snapshot()
+}
+
+// Restore goes back to the state saved by Snapshot on the same song
+func (s *StSound) Restore(snapshot []byte) error {
+	return s.music.Restore(snapshot)
+}
+
 // SetLowpassFilter enables/disables the lowpass filter
 func (s *StSound) SetLowpassFilter(active bool) {
 	s.music.SetLowpassFilter(YmBool(active))
 }
+
+// SetFilterChain replaces the output filters (DC blocker and 3-tap low-pass
+// by default) with an ordered list of stages, see ParseFilterChain.
+// SetLowpassFilter goes back to the default chain.
+func (s *StSound) SetFilterChain(stages []FilterStage) {
+	s.music.SetFilterChain(stages)
+}
+
+// ParseVoices reads a list of voice letters such as "a,c" and returns
+// their indexes (VOICE_A, VOICE_B, VOICE_C)
+func ParseVoices(list string) ([]int, error) {
+	var voices []int
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if len(name) != 1 || name[0] < 'a' || name[0] > 'c' {
+			return nil, fmt.Errorf("invalid voice %q: expected a, b or c", name)
+		}
+		voices = append(voices, int(name[0]-'a'))
+	}
+	return voices, nil
+}
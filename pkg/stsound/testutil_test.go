@@ -0,0 +1,467 @@
+package stsound
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/olivierh59500/ym-player/pkg/lzh"
+)
+
+// Songs and renders shared by the tests
+
+// fuzzSeeds builds a small valid file of each supported format
+func fuzzSeeds(tb testing.TB) [][]byte {
+	var seeds [][]byte
+
+	// YM2!, YM3! and YM3b: 14 registres par frame, entrelacés
+	frames := make([]byte, 14*20)
+	for i := range frames {
+		frames[i] = byte(i * 7)
+	}
+	seeds = append(seeds,
+		append([]byte("YM2!"), frames...),
+		append([]byte("YM3!"), frames...),
+		binary.LittleEndian.AppendUint32(append([]byte("YM3b"), frames...), 5))
+
+	// YM4! with one digidrum
+	ym4 := []byte("YM4!LeOnArD!")
+	ym4 = binary.BigEndian.AppendUint32(ym4, 20)
+	ym4 = binary.BigEndian.AppendUint32(ym4, A_STREAMINTERLEAVED)
+	ym4 = binary.BigEndian.AppendUint32(ym4, 1)
+	ym4 = binary.BigEndian.AppendUint32(ym4, 0)
+	ym4 = binary.BigEndian.AppendUint32(ym4, 16)
+	ym4 = append(ym4, make([]byte, 16)...)
+	ym4 = append(ym4, "name\x00author\x00comment\x00"...)
+	ym4 = append(ym4, make([]byte, 16*20)...)
+	seeds = append(seeds, append(ym4, "End!"...))
+
+	// YM5! and YM6! through the writer, with effects on every frame
+	for _, format := range []YmFileType{YM_V5, YM_V6} {
+		song := &YmSong{
+			Format:      format,
+			Frames:      make([][16]byte, 20),
+			DigiDrums:   []DigiDrum{{Size: 8, Data: make([]YmU8, 8)}},
+			Interleaved: true,
+			SongName:    "name",
+		}
+		for i := range song.Frames {
+			song.Frames[i] = [16]byte{1: 0x10, 3: 0x60, 6: 0x20, 8: 0x20, 14: 10, 15: 20}
+		}
+		data, err := EncodeYM(song)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		seeds = append(seeds, data)
+		if format == YM_V6 {
+			packed, err := lzh.Compress("song.ym", data, time.Time{})
+			if err != nil {
+				tb.Fatal(err)
+			}
+			seeds = append(seeds, packed)
+		}
+	}
+
+	// MIX1 with two blocks
+	mix := []byte("MIX1LeOnArD!")
+	mix = binary.BigEndian.AppendUint32(mix, 0)
+	mix = binary.BigEndian.AppendUint32(mix, 64)
+	mix = binary.BigEndian.AppendUint32(mix, 2)
+	mix = binary.BigEndian.AppendUint32(mix, 0)
+	mix = binary.BigEndian.AppendUint32(mix, 32)
+	mix = binary.BigEndian.AppendUint16(mix, 2)
+	mix = binary.BigEndian.AppendUint16(mix, 8000)
+	mix = binary.BigEndian.AppendUint32(mix, 32)
+	mix = binary.BigEndian.AppendUint32(mix, 32)
+	mix = binary.BigEndian.AppendUint16(mix, 1)
+	mix = binary.BigEndian.AppendUint16(mix, 11025)
+	mix = append(mix, "name\x00author\x00comment\x00"...)
+	seeds = append(seeds, append(mix, make([]byte, 64)...))
+
+	// YMT2 with one looping sample
+	ymt := []byte("YMT2LeOnArD!")
+	ymt = binary.BigEndian.AppendUint16(ymt, 2)
+	ymt = binary.BigEndian.AppendUint16(ymt, 50)
+	ymt = binary.BigEndian.AppendUint32(ymt, 10)
+	ymt = binary.BigEndian.AppendUint32(ymt, 0)
+	ymt = binary.BigEndian.AppendUint16(ymt, 1)
+	ymt = binary.BigEndian.AppendUint32(ymt, 1<<28)
+	ymt = append(ymt, "name\x00author\x00comment\x00"...)
+	ymt = binary.BigEndian.AppendUint16(ymt, 16)
+	ymt = binary.BigEndian.AppendUint16(ymt, 8)
+	ymt = binary.BigEndian.AppendUint16(ymt, 0)
+	ymt = append(ymt, make([]byte, 16)...)
+	for i := 0; i < 10*2; i++ {
+		ymt = append(ymt, 0, 0x7f, 0x10, 0)
+	}
+	seeds = append(seeds, ymt)
+
+	// Quelques vrais fichiers s'ils sont disponibles
+	files, _ := filepath.Glob("../../test/testdata/*/*.ym")
+	for i := 0; i < len(files) && i < 4; i++ {
+		if data, err := os.ReadFile(files[i]); err == nil {
+			seeds = append(seeds, data)
+		}
+	}
+	return seeds
+}
+
+// ym4File builds an interleaved YM4 file with one digidrum
+func ym4File(frames [][16]byte, loopFrame uint32, drum []byte) []byte {
+	ym4 := []byte("YM4!LeOnArD!")
+	ym4 = binary.BigEndian.AppendUint32(ym4, uint32(len(frames)))
+	ym4 = binary.BigEndian.AppendUint32(ym4, A_STREAMINTERLEAVED)
+	ym4 = binary.BigEndian.AppendUint32(ym4, 1)
+	ym4 = binary.BigEndian.AppendUint32(ym4, loopFrame)
+	ym4 = binary.BigEndian.AppendUint32(ym4, uint32(len(drum)))
+	ym4 = append(ym4, drum...)
+	ym4 = append(ym4, "name\x00author\x00comment\x00"...)
+	for reg := 0; reg < 16; reg++ {
+		for _, frame := range frames {
+			ym4 = append(ym4, frame[reg])
+		}
+	}
+	return append(ym4, "End!"...)
+}
+
+// mixFile builds a MIX1 file of 160 samples at 8000Hz: block 0 plays the
+// first half twice, block 1 the second half once
+func mixFile(attrib uint32, samples []byte) []byte {
+	mix := []byte("MIX1LeOnArD!")
+	mix = binary.BigEndian.AppendUint32(mix, attrib)
+	mix = binary.BigEndian.AppendUint32(mix, uint32(len(samples)))
+	mix = binary.BigEndian.AppendUint32(mix, 2)
+	for _, block := range [][3]uint32{{0, 80, 2}, {80, 80, 1}} {
+		mix = binary.BigEndian.AppendUint32(mix, block[0])
+		mix = binary.BigEndian.AppendUint32(mix, block[1])
+		mix = binary.BigEndian.AppendUint16(mix, uint16(block[2]))
+		mix = binary.BigEndian.AppendUint16(mix, 8000)
+	}
+	mix = append(mix, "name\x00author\x00comment\x00"...)
+	return append(mix, samples...)
+}
+
+// trackerFile builds a one-voice YMT1 file with a single sample, one line
+// of 4 bytes per frame (note, volume, frequency)
+func trackerFile(loopFrame uint32, drum []byte, lines [][4]byte) []byte {
+	ymt := []byte("YMT1LeOnArD!")
+	ymt = binary.BigEndian.AppendUint16(ymt, 1)
+	ymt = binary.BigEndian.AppendUint16(ymt, 50)
+	ymt = binary.BigEndian.AppendUint32(ymt, uint32(len(lines)))
+	ymt = binary.BigEndian.AppendUint32(ymt, loopFrame)
+	ymt = binary.BigEndian.AppendUint16(ymt, 1)
+	ymt = binary.BigEndian.AppendUint32(ymt, 0)
+	ymt = append(ymt, "name\x00author\x00comment\x00"...)
+	ymt = binary.BigEndian.AppendUint16(ymt, uint16(len(drum)))
+	ymt = append(ymt, drum...)
+	for _, line := range lines {
+		ymt = append(ymt, line[:]...)
+	}
+	return ymt
+}
+
+// ymSources returns a plain and a packed YM6 song, and a file system holding both
+func ymSources(t *testing.T) (plain, packed []byte, fsys fstest.MapFS) {
+	plain = seekSong(t)
+	packed, err := lzh.Compress("song.ym", plain, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys = fstest.MapFS{
+		"songs/plain.ym":  {Data: plain},
+		"songs/packed.ym": {Data: packed},
+		"songs/junk.ym":   {Data: []byte("not a YM file")},
+	}
+	return plain, packed, fsys
+}
+
+// errRead is the error of the failing readers
+var errRead = errors.New("read failed")
+
+// endSong builds a YM5 of nbFrame frames whose registers never repeat: a
+// new note and volume on every frame
+func endSong(nbFrame int) *YmSong {
+	song := &YmSong{Format: YM_V5, Frames: make([][16]byte, nbFrame)}
+	seed := uint32(1)
+	for i := range song.Frames {
+		f := &song.Frames[i]
+		for reg := 0; reg < 6; reg++ {
+			seed = seed*1664525 + 1013904223
+			f[reg] = byte(seed >> 24)
+		}
+		f[7] = 0x38
+		f[8], f[9], f[10] = byte(8+i%8), byte(15-i%7), 12
+		f[13] = 0xff
+	}
+	return song
+}
+
+// voiceSong plays a square wave on a single voice, at full volume
+func voiceSong(t *testing.T, voice int) []byte {
+	t.Helper()
+	song := &YmSong{Format: YM_V5, Frames: make([][16]byte, 50)}
+	for i := range song.Frames {
+		f := &song.Frames[i]
+		f[2*voice] = 100
+		f[7] = 0x3f &^ (1 << voice)
+		f[8+voice] = 15
+		f[13] = 0xff
+	}
+	data, err := EncodeYM(song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// seekSong builds a 14 seconds YM6 whose registers change on every frame,
+// with envelope restarts and digidrums
+func seekSong(tb testing.TB) []byte {
+	song := &YmSong{
+		Format:    YM_V6,
+		Frames:    make([][16]byte, 14*50),
+		DigiDrums: []DigiDrum{{Size: 64, Data: make([]YmU8, 64)}},
+	}
+	for i := range song.DigiDrums[0].Data {
+		song.DigiDrums[0].Data[i] = YmU8(i * 4)
+	}
+	for i := range song.Frames {
+		f := &song.Frames[i]
+		f[0], f[1] = byte(i*7), byte(i/40)&15
+		f[2], f[3] = byte(i*3), 2
+		f[4], f[5] = byte(255-i), 1
+		f[6] = byte(i) & 31
+		f[7] = 0x38 ^ byte(i/25)&0x3f
+		f[8], f[9], f[10] = 0x10, byte(i)&15, 12
+		f[11], f[12] = byte(i), 1
+		f[13] = 0xff
+		if i%37 == 0 {
+			f[13] = byte(i/37) & 15
+		}
+		if i%50 == 10 {
+			f[3], f[8], f[14], f[15] = 0x60, 0x20, 10, 20
+		}
+	}
+	data, err := EncodeYM(song)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// chipSong goes through the 16 envelope shapes on voice A, with tone and
+// noise at changing volumes on B and C
+func chipSong(t *testing.T) []byte {
+	t.Helper()
+	song := &YmSong{Format: YM_V5, Frames: make([][16]byte, 16*25)}
+	for i := range song.Frames {
+		f := &song.Frames[i]
+		f[0], f[1] = byte(40+i), 0
+		f[2], f[3] = byte(i*7), byte(i>>6)
+		f[4], f[5] = 200, 1
+		f[6] = byte(i % 32)
+		f[7] = 0x0c // tone A et B, bruit B et C
+		f[8] = 0x10
+		f[9] = byte(15 - i%16)
+		f[10] = byte(i % 16)
+		f[11], f[12] = byte(i*13), byte(i%25/5)
+		f[13] = 0xff
+		if i%25 == 0 {
+			f[13] = byte(i / 25)
+		}
+	}
+	data, err := EncodeYM(song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// mixSong plays the given voices at full volume, each on its own period
+func mixSong(t *testing.T, voices ...int) []byte {
+	t.Helper()
+	song := &YmSong{Format: YM_V5, Frames: make([][16]byte, 50)}
+	for i := range song.Frames {
+		f := &song.Frames[i]
+		f[7] = 0x3f
+		for _, voice := range voices {
+			f[2*voice] = byte(100 + 30*voice)
+			f[7] &^= 1 << voice
+			f[8+voice] = 15
+		}
+		f[13] = 0xff
+	}
+	data, err := EncodeYM(song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// compressedMixTable stands in for a measured table: the summed level grows
+// slower than the sum of the voices. Ce n'est pas une mesure.
+func compressedMixTable() *MixTable {
+	table := new(MixTable)
+	for i := range table {
+		var sum float64
+		for _, v := range []int{i >> 8, (i >> 4) & 15, i & 15} {
+			sum += ymDacTable[2*v+1]
+		}
+		table[i] = uint16(math.Round(1000 + 60000*sum/(sum+0.5)))
+	}
+	return table
+}
+
+// renderTracks renders 2s of each voice without output filters
+func renderTracks(t *testing.T, data []byte, setup func(ym *CYmMusic)) [3][]YmSample {
+	t.Helper()
+	ym := NewYmMusic(44100)
+	if err := ym.LoadMemory(data); err != nil {
+		t.Fatal(err)
+	}
+	ym.SetFilterChain(nil)
+	setup(ym)
+	ym.Play()
+
+	var tracks [3][]YmSample
+	for i := range tracks {
+		tracks[i] = make([]YmSample, 2*44100)
+	}
+	ym.UpdateMultitrack(tracks, nil, len(tracks[0]))
+	return tracks
+}
+
+// renderHash renders the whole song with the default settings
+func renderHash(t *testing.T, data []byte, setup func(ym *CYmMusic)) uint64 {
+	t.Helper()
+	ym := NewYmMusic(44100)
+	setup(ym)
+	if err := ym.LoadMemory(data); err != nil {
+		t.Fatal(err)
+	}
+	ym.Play()
+	buffer := make([]YmSample, 8*44100)
+	ym.Update(buffer, len(buffer))
+
+	h := fnv.New64a()
+	for _, s := range buffer {
+		h.Write([]byte{byte(s), byte(s >> 8)})
+	}
+	return h.Sum64()
+}
+
+// renderTone plays a square wave of the given period on voice A and returns
+// 1s of output without filters nor DC
+func renderTone(t *testing.T, core YmCore, rate, period int) []float64 {
+	t.Helper()
+	song := &YmSong{Format: YM_V5, Frames: make([][16]byte, 60)}
+	for i := range song.Frames {
+		f := &song.Frames[i]
+		f[0], f[1] = byte(period), byte(period>>8)
+		f[7] = 0x3e
+		f[8] = 15
+		f[13] = 0xff
+	}
+	data, err := EncodeYM(song)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ym := NewYmMusic(rate)
+	ym.SetCore(core)
+	if err := ym.LoadMemory(data); err != nil {
+		t.Fatal(err)
+	}
+	ym.SetFilterChain(nil)
+	ym.Play()
+	// Le début laisse le temps au resampler de se remplir
+	buffer := make([]YmSample, rate/10+rate)
+	ym.Update(buffer, len(buffer))
+
+	out := make([]float64, rate)
+	var mean float64
+	for i := range out {
+		out[i] = float64(buffer[rate/10+i])
+		mean += out[i]
+	}
+	mean /= float64(len(out))
+	for i := range out {
+		out[i] -= mean
+	}
+	return out
+}
+
+// stereoLevels renders a stereo buffer and returns the RMS of each side
+func stereoLevels(t *testing.T, data []byte, pans [3]float64) (left, right float64) {
+	t.Helper()
+	ym := NewYmMusic(44100)
+	if err := ym.LoadMemory(data); err != nil {
+		t.Fatal(err)
+	}
+	ym.SetPanning(pans)
+	ym.Play()
+	buffer := make([]YmSample, 2*8820)
+	ym.UpdateStereo(buffer, len(buffer)/2)
+
+	var sum, energy [2]float64
+	for i, s := range buffer {
+		sum[i%2] += float64(s)
+	}
+	n := float64(len(buffer) / 2)
+	for i, s := range buffer {
+		d := float64(s) - sum[i%2]/n
+		energy[i%2] += d * d
+	}
+	return math.Sqrt(energy[0] / n), math.Sqrt(energy[1] / n)
+}
+
+// analyze encodes the song and looks for its end
+func analyze(t *testing.T, song *YmSong, opts AnalyzeOptions) TuneEnd {
+	t.Helper()
+	data, err := EncodeYM(song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := AnalyzeTune(data, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return end
+}
+
+// rms returns the root mean square of a signal
+func rms(signal []float64) float64 {
+	var energy float64
+	for _, s := range signal {
+		energy += s * s
+	}
+	return math.Sqrt(energy / float64(len(signal)))
+}
+
+// stageNames lists the names of a filter chain
+func stageNames(stages []FilterStage) []string {
+	names := make([]string, len(stages))
+	for i, stage := range stages {
+		names[i] = stage.Name
+	}
+	return names
+}
+
+// copyFilter duplicates a filter with its state
+func copyFilter(f Filter) Filter {
+	switch f := f.(type) {
+	case *DcAdjuster:
+		c := *f
+		return &c
+	case *Biquad:
+		c := *f
+		return &c
+	}
+	panic("copyFilter: unexpected filter")
+}
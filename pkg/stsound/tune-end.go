@@ -0,0 +1,169 @@
+package stsound
+
+import (
+	"bytes"
+	"time"
+)
+
+// AnalyzeOptions tunes AnalyzeTune, zero fields select the defaults
+type AnalyzeOptions struct {
+	Silence   time.Duration // Shortest silence that ends the song (default 4s)
+	Threshold int           // Peak level under which the output is silent (default 64)
+	Repeat    time.Duration // Shortest register sequence whose repetition is a loop (default 8s)
+	Machine   *Machine      // Profile used for playback, nil to follow the file header
+}
+
+// TuneEnd is the end of a song found by AnalyzeTune, times are in ms
+type TuneEnd struct {
+	LengthInMs uint32 // One pass through the song data, as GetMusicTime
+	EndInMs    uint32 // Suggested end, LengthInMs when nothing was found
+	LoopInMs   uint32 // Suggested loop point, the one of the song when no repeat was found
+	Silence    bool   // EndInMs is the start of a sustained silence
+	Repeat     bool   // From EndInMs, the registers repeat those played from LoopInMs
+}
+
+const (
+	// Le rendu de l'analyse n'a besoin que du niveau de sortie
+	analyzeRate = 11025
+
+	defaultSilence   = 4 * time.Second
+	defaultThreshold = 64
+	defaultRepeat    = 8 * time.Second
+)
+
+// AnalyzeTune plays a song once to find where it really ends: many rips run
+// on with a long silence, or play the tune again before the data ends.
+//
+// The rendering is searched for the first silence of at least opts.Silence
+// after some sound. The register stream of YM2 to YM6 songs is searched for
+// the first frame from which the rest of the song repeats an earlier part
+// of at least opts.Repeat, an implicit loop. EndInMs is the earliest of the
+// two, the song is left unchanged.
+func AnalyzeTune(data []byte, opts AnalyzeOptions) (TuneEnd, error) {
+	if opts.Silence <= 0 {
+		opts.Silence = defaultSilence
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = defaultThreshold
+	}
+	if opts.Repeat <= 0 {
+		opts.Repeat = defaultRepeat
+	}
+
+	ym := NewYmMusic(analyzeRate)
+	defer ym.UnLoad()
+	ym.SetMachine(opts.Machine)
+	if err := ym.LoadMemory(data); err != nil {
+		return TuneEnd{}, err
+	}
+
+	end := TuneEnd{LengthInMs: uint32(ym.songTime()), LoopInMs: uint32(ym.loopStart())}
+	end.EndInMs = end.LengthInMs
+	if start, ok := ym.findSilence(opts); ok {
+		end.EndInMs = start
+		end.Silence = true
+	}
+
+	// La répétition est cherchée avant le silence, qui ne se répète pas
+	if ym.songType >= YM_V2 && ym.songType < YM_VMAX && ym.playerRate > 0 {
+		rate := int64(ym.playerRate)
+		frames := min(int(int64(end.EndInMs)*rate/1000), ym.nbFrame)
+		window := int(opts.Repeat.Milliseconds() * rate / 1000)
+		if t, s, ok := ym.findRepeat(frames, window); ok {
+			end.EndInMs = uint32(int64(t) * 1000 / rate)
+			end.LoopInMs = uint32(int64(s) * 1000 / rate)
+			end.Silence = false
+			end.Repeat = true
+		}
+	}
+	return end, nil
+}
+
+// findSilence renders the song once and returns when the first silence of
+// at least opts.Silence starts, in ms. Silences before the first sound do
+// not count.
+func (ym *CYmMusic) findSilence(opts AnalyzeOptions) (uint32, bool) {
+	nbs := analyzeRate / 50
+	if ym.playerRate > 0 {
+		nbs = ym.vblNbSample()
+	}
+	minRun := opts.Silence.Milliseconds() * analyzeRate / 1000
+
+	buffer := make([]YmSample, nbs)
+	var pos int64
+	silenceStart := int64(-1)
+	heard := false
+	ym.Play()
+	for ym.updateMono(buffer, nbs) {
+		loud := false
+		for _, s := range buffer {
+			if int(s) > opts.Threshold || int(s) < -opts.Threshold {
+				loud = true
+				break
+			}
+		}
+		if loud {
+			heard = true
+			silenceStart = -1
+		} else if heard && silenceStart < 0 {
+			silenceStart = pos
+		}
+		pos += int64(nbs)
+
+		if silenceStart >= 0 && pos-silenceStart >= minRun {
+			return uint32(silenceStart * 1000 / analyzeRate), true
+		}
+	}
+	return 0, false
+}
+
+// findRepeat returns the first frame t from which frames t to n are those
+// played from an earlier frame s, with t-s and n-t of at least window frames
+func (ym *CYmMusic) findRepeat(n, window int) (int, int, bool) {
+	if window <= 0 || n < 2*window {
+		return 0, 0, false
+	}
+	inc := ym.streamInc
+	frames := ym.pDataStream
+
+	// FNV-1a de chaque frame, puis hash glissant des fenêtres de window frames
+	const prime = 1099511628211
+	hashes := make([]uint64, n)
+	for i := range hashes {
+		h := uint64(14695981039346656037)
+		for _, b := range frames[i*inc : (i+1)*inc] {
+			h = (h ^ uint64(b)) * prime
+		}
+		hashes[i] = h
+	}
+	pow := uint64(1)
+	for i := 0; i < window; i++ {
+		pow *= prime
+	}
+	windows := make([]uint64, n-window+1)
+	var h uint64
+	for i := 0; i < n; i++ {
+		h = h*prime + hashes[i]
+		if i >= window {
+			h -= hashes[i-window] * pow
+		}
+		if i >= window-1 {
+			windows[i-window+1] = h
+		}
+	}
+
+	// Quelques positions par hash suffisent, les premières sont les bonnes
+	const maxCandidates = 4
+	seen := make(map[uint64][]int)
+	for t := window; t+window <= n; t++ {
+		if s := t - window; len(seen[windows[s]]) < maxCandidates {
+			seen[windows[s]] = append(seen[windows[s]], s)
+		}
+		for _, s := range seen[windows[t]] {
+			if bytes.Equal(frames[t*inc:n*inc], frames[s*inc:(s+n-t)*inc]) {
+				return t, s, true
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,51 @@
+package stsound
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyzeTune(t *testing.T) {
+	// Rien à trouver : la fin est celle du morceau
+	song := endSong(20 * 50)
+	song.LoopFrame = 100
+	end := analyze(t, song, AnalyzeOptions{})
+	if end != (TuneEnd{LengthInMs: 20000, EndInMs: 20000, LoopInMs: 2000}) {
+		t.Errorf("plain song: %+v", end)
+	}
+
+	// 6s de musique puis 10s de silence
+	song = endSong(16 * 50)
+	for i := 6 * 50; i < len(song.Frames); i++ {
+		song.Frames[i][8], song.Frames[i][9], song.Frames[i][10] = 0, 0, 0
+	}
+	end = analyze(t, song, AnalyzeOptions{})
+	if !end.Silence || end.Repeat || end.EndInMs < 6000 || end.EndInMs > 6100 {
+		t.Errorf("silent tail: %+v, want a silence at 6000ms", end)
+	}
+	if end = analyze(t, song, AnalyzeOptions{Silence: 12 * time.Second}); end.Silence {
+		t.Errorf("silent tail shorter than Silence: %+v", end)
+	}
+
+	// 12s, puis la musique reprend à 3s jusqu'à la fin des données
+	song = endSong(20 * 50)
+	copy(song.Frames[12*50:], song.Frames[3*50:])
+	end = analyze(t, song, AnalyzeOptions{})
+	if end != (TuneEnd{LengthInMs: 20000, EndInMs: 12000, LoopInMs: 3000, Repeat: true}) {
+		t.Errorf("repeated tune: %+v, want a repeat from 3000ms at 12000ms", end)
+	}
+	if end = analyze(t, song, AnalyzeOptions{Repeat: 10 * time.Second}); end.Repeat {
+		t.Errorf("repeat shorter than Repeat: %+v", end)
+	}
+
+	// La reprise suivie d'un silence est trouvée avant le silence
+	song = endSong(30 * 50)
+	copy(song.Frames[12*50:20*50], song.Frames[3*50:])
+	for i := 20 * 50; i < len(song.Frames); i++ {
+		song.Frames[i][8], song.Frames[i][9], song.Frames[i][10] = 0, 0, 0
+	}
+	end = analyze(t, song, AnalyzeOptions{})
+	if !end.Repeat || end.EndInMs != 12000 || end.LoopInMs != 3000 {
+		t.Errorf("repeat then silence: %+v", end)
+	}
+}
@@ -55,6 +55,7 @@ const (
 	AMSTRAD_CLOCK  = 1000000
 	ATARI_CLOCK    = 2000000
 	SPECTRUM_CLOCK = 1773400
+	MSX_CLOCK      = 1789772
 	MFP_CLOCK      = 2457600
 	NOISESIZE      = 16384
 	DRUM_PREC      = 15
@@ -125,6 +126,7 @@ type YmSpecialEffect struct {
 	DrumStep YmU32
 
 	Sid     YmBool
+	SidSin  YmBool
 	SidPos  YmU32
 	SidStep YmU32
 	SidVol  YmInt
@@ -3,7 +3,11 @@ package stsound
 import (
 	//	"bytes"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
+	"strings"
 
 	"github.com/olivierh59500/ym-player/pkg/lzh"
 )
@@ -15,7 +19,28 @@ func LoadYMFile(filename string) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	return depackYMData(data)
+}
+
+// LoadYMReader reads a whole YM stream and depacks it if needed
+func LoadYMReader(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+	return depackYMData(data)
+}
+
+// LoadYMFS loads a YM file from a file system such as embed.FS
+func LoadYMFS(fsys fs.FS, name string) ([]byte, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return depackYMData(data)
+}
 
+func depackYMData(data []byte) ([]byte, error) {
 	// Check if it's compressed
 	if lzh.IsLZHCompressed(data) {
 		// Decompress
@@ -51,6 +76,11 @@ func IsYMFile(data []byte) bool {
 	return false
 }
 
+// IsYMFileName checks the file extension of a YM tune
+func IsYMFileName(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".ym")
+}
+
 // GetYMInfo returns basic information about a YM file without full loading
 func GetYMInfo(data []byte) (format string, compressed bool, err error) {
 	// Check if compressed
@@ -96,6 +126,29 @@ func GetYMInfo(data []byte) (format string, compressed bool, err error) {
 	return format, false, nil
 }
 
+// ymInfoHeaderSize is enough to identify both a YM signature and an LZH method
+const ymInfoHeaderSize = 7
+
+// GetYMInfoReader identifies a YM stream, reading only its first bytes
+func GetYMInfoReader(r io.Reader) (format string, compressed bool, err error) {
+	header := make([]byte, ymInfoHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", false, err
+	}
+	return GetYMInfo(header[:n])
+}
+
+// GetYMInfoFS identifies a YM file stored in a file system
+func GetYMInfoFS(fsys fs.FS, name string) (format string, compressed bool, err error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	return GetYMInfoReader(f)
+}
+
 // AutoDetectAndLoad automatically detects the file format and loads it appropriately
 func AutoDetectAndLoad(filename string) (*CYmMusic, error) {
 	// Load file data
@@ -0,0 +1,85 @@
+package stsound
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLoadReaderFS(t *testing.T) {
+	plain, packed, fsys := ymSources(t)
+
+	for _, tc := range []struct {
+		name string
+		load func(ym *CYmMusic) error
+		err  error // nil si le chargement réussit
+	}{
+		{"reader", func(ym *CYmMusic) error { return ym.LoadReader(bytes.NewReader(plain)) }, nil},
+		{"packed reader", func(ym *CYmMusic) error { return ym.LoadReader(bytes.NewReader(packed)) }, nil},
+		{"one byte reads", func(ym *CYmMusic) error { return ym.LoadReader(iotest.OneByteReader(bytes.NewReader(packed))) }, nil},
+		{"reader error", func(ym *CYmMusic) error {
+			return ym.LoadReader(io.MultiReader(bytes.NewReader(plain[:100]), iotest.ErrReader(errRead)))
+		}, errRead},
+		{"junk reader", func(ym *CYmMusic) error { return ym.LoadReader(bytes.NewReader([]byte("not a YM file"))) }, ErrUnsupportedFormat},
+		{"fs", func(ym *CYmMusic) error { return ym.LoadFS(fsys, "songs/plain.ym") }, nil},
+		{"packed fs", func(ym *CYmMusic) error { return ym.LoadFS(fsys, "songs/packed.ym") }, nil},
+		{"missing file", func(ym *CYmMusic) error { return ym.LoadFS(fsys, "songs/missing.ym") }, fs.ErrNotExist},
+		{"junk file", func(ym *CYmMusic) error { return ym.LoadFS(fsys, "songs/junk.ym") }, ErrUnsupportedFormat},
+	} {
+		ym := NewYmMusic(44100)
+		err := tc.load(ym)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%s: %v, want %v", tc.name, err, tc.err)
+			}
+			if ym.bMusicOk {
+				t.Errorf("%s: a song is loaded after the error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if info := ym.GetMusicInfo(); info.SongType != "YM 6" || info.MusicTimeInMs != 14000 {
+			t.Errorf("%s: info %+v", tc.name, info)
+		}
+	}
+}
+
+func TestGetYMInfoReaderFS(t *testing.T) {
+	plain, packed, fsys := ymSources(t)
+
+	for _, tc := range []struct {
+		name       string
+		info       func() (string, bool, error)
+		format     string
+		compressed bool
+		err        error
+	}{
+		{"reader", func() (string, bool, error) { return GetYMInfoReader(bytes.NewReader(plain)) }, "YM6!", false, nil},
+		{"packed reader", func() (string, bool, error) { return GetYMInfoReader(bytes.NewReader(packed)) }, "Compressed YM (-lh5-)", true, nil},
+		{"short reader", func() (string, bool, error) { return GetYMInfoReader(bytes.NewReader([]byte("YM5!"))) }, "YM5!", false, nil},
+		{"reader error", func() (string, bool, error) { return GetYMInfoReader(iotest.ErrReader(errRead)) }, "", false, errRead},
+		{"fs", func() (string, bool, error) { return GetYMInfoFS(fsys, "songs/plain.ym") }, "YM6!", false, nil},
+		{"packed fs", func() (string, bool, error) { return GetYMInfoFS(fsys, "songs/packed.ym") }, "Compressed YM (-lh5-)", true, nil},
+		{"missing file", func() (string, bool, error) { return GetYMInfoFS(fsys, "songs/missing.ym") }, "", false, fs.ErrNotExist},
+	} {
+		format, compressed, err := tc.info()
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%s: %v, want %v", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || format != tc.format || compressed != tc.compressed {
+			t.Errorf("%s: %q, %v, %v, want %q, %v", tc.name, format, compressed, err, tc.format, tc.compressed)
+		}
+	}
+
+	// Un fichier qui n'est pas un YM est reconnu sans tout lire
+	if _, _, err := GetYMInfoFS(fsys, "songs/junk.ym"); err == nil {
+		t.Error("junk file identified as a YM file")
+	}
+}
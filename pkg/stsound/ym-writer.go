@@ -0,0 +1,148 @@
+package stsound
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// YmSong describes a register-frame stream to be written as a YM5!/YM6! file
+type YmSong struct {
+	Format      YmFileType // YM_V5 or YM_V6
+	Frames      [][16]byte // Registers r0-r15 for each frame
+	DigiDrums   []DigiDrum
+	LoopFrame   int
+	Clock       YmU32 // Chip master clock, ATARI_CLOCK if zero
+	PlayerRate  int   // Frames per second, 50 if zero
+	Interleaved bool  // Store the stream register by register (packs better)
+
+	SongName    string
+	SongAuthor  string
+	SongComment string
+}
+
+// EncodeYM serializes a song to an uncompressed YM5!/YM6! file image
+func EncodeYM(song *YmSong) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteYM(&buf, song); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteYM writes a song as an uncompressed YM5!/YM6! file
+func WriteYM(w io.Writer, song *YmSong) error {
+	if err := song.validate(); err != nil {
+		return err
+	}
+
+	clock := song.Clock
+	if clock == 0 {
+		clock = ATARI_CLOCK
+	}
+	rate := song.PlayerRate
+	if rate == 0 {
+		rate = 50
+	}
+
+	var attrib YmU32
+	if song.Interleaved {
+		attrib |= A_STREAMINTERLEAVED
+	}
+
+	var buf bytes.Buffer
+
+	// En-tête, toujours en big-endian
+	if song.Format == YM_V6 {
+		buf.WriteString("YM6!")
+	} else {
+		buf.WriteString("YM5!")
+	}
+	buf.WriteString("LeOnArD!")
+	writeMotorolaDword(&buf, YmU32(len(song.Frames)))
+	writeMotorolaDword(&buf, attrib)
+	writeMotorolaWord(&buf, YmU16(len(song.DigiDrums)))
+	writeMotorolaDword(&buf, clock)
+	writeMotorolaWord(&buf, YmU16(rate))
+	writeMotorolaDword(&buf, YmU32(song.LoopFrame))
+	writeMotorolaWord(&buf, 0) // No additional data
+
+	// Digidrums, 8 bits non signés
+	for i := range song.DigiDrums {
+		drum := &song.DigiDrums[i]
+		writeMotorolaDword(&buf, drum.Size)
+		for _, v := range drum.Data[:drum.Size] {
+			buf.WriteByte(byte(v))
+		}
+	}
+
+	// Métadonnées (null-terminated strings)
+	writeNtString(&buf, song.SongName)
+	writeNtString(&buf, song.SongAuthor)
+	writeNtString(&buf, song.SongComment)
+
+	// Register stream
+	nbFrame := len(song.Frames)
+	if song.Interleaved {
+		for reg := 0; reg < 16; reg++ {
+			for frame := 0; frame < nbFrame; frame++ {
+				buf.WriteByte(song.Frames[frame][reg])
+			}
+		}
+	} else {
+		for frame := 0; frame < nbFrame; frame++ {
+			buf.Write(song.Frames[frame][:])
+		}
+	}
+
+	buf.WriteString("End!")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (song *YmSong) validate() error {
+	if song.Format != YM_V5 && song.Format != YM_V6 {
+		return fmt.Errorf("unsupported output format: %d", song.Format)
+	}
+	if len(song.Frames) == 0 {
+		return errors.New("song has no frames")
+	}
+	if song.LoopFrame < 0 || song.LoopFrame >= len(song.Frames) {
+		return fmt.Errorf("loop frame %d out of range", song.LoopFrame)
+	}
+	if song.PlayerRate < 0 || song.PlayerRate > 0xffff {
+		return fmt.Errorf("invalid player rate: %d", song.PlayerRate)
+	}
+	// Les effets ne peuvent adresser que 32 digidrums
+	if len(song.DigiDrums) > 32 {
+		return fmt.Errorf("too many digidrums: %d", len(song.DigiDrums))
+	}
+	for i := range song.DigiDrums {
+		if YmU32(len(song.DigiDrums[i].Data)) < song.DigiDrums[i].Size {
+			return fmt.Errorf("digidrum %d shorter than its size", i)
+		}
+	}
+	for _, s := range []string{song.SongName, song.SongAuthor, song.SongComment} {
+		if strings.IndexByte(s, 0) >= 0 {
+			return errors.New("metadata must not contain NUL characters")
+		}
+	}
+	return nil
+}
+
+// Écriture dans un buffer avec big-endian (Motorola byte order)
+func writeMotorolaDword(buf *bytes.Buffer, v YmU32) {
+	buf.Write([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+func writeMotorolaWord(buf *bytes.Buffer, v YmU16) {
+	buf.Write([]byte{byte(v >> 8), byte(v)})
+}
+
+func writeNtString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.WriteByte(0)
+}
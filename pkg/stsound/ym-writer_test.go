@@ -0,0 +1,79 @@
+package stsound
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestWriteYM(t *testing.T) {
+	frames := make([][16]byte, 40)
+	seed := uint32(7)
+	for i := range frames {
+		for reg := range frames[i] {
+			seed = seed*1664525 + 1013904223
+			frames[i][reg] = byte(seed >> 24)
+		}
+	}
+	drums := []DigiDrum{
+		{Size: 4, Data: []YmU8{0x80, 0xff, 0x80, 0}},
+		{Size: 3, Data: []YmU8{1, 2, 3, 4}}, // octets au-delà de Size ignorés
+	}
+
+	for _, format := range []YmFileType{YM_V5, YM_V6} {
+		for _, interleaved := range []bool{false, true} {
+			song := &YmSong{
+				Format:      format,
+				Frames:      frames,
+				DigiDrums:   drums,
+				LoopFrame:   7,
+				Clock:       AMSTRAD_CLOCK,
+				PlayerRate:  60,
+				Interleaved: interleaved,
+				SongName:    "name",
+				SongAuthor:  "author",
+				SongComment: "comment",
+			}
+			data, err := EncodeYM(song)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var w bytes.Buffer
+			if err := WriteYM(&w, song); err != nil || !bytes.Equal(w.Bytes(), data) {
+				t.Errorf("format %d, interleaved %v: WriteYM differs from EncodeYM (%v)", format, interleaved, err)
+			}
+
+			ym := NewYmMusic(44100)
+			if err := ym.LoadMemory(data); err != nil {
+				t.Fatalf("format %d, interleaved %v: %v", format, interleaved, err)
+			}
+			got, err := ym.Song()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format != format || got.LoopFrame != 7 || got.Clock != AMSTRAD_CLOCK || got.PlayerRate != 60 ||
+				got.SongName != "name" || got.SongAuthor != "author" || got.SongComment != "comment" {
+				t.Errorf("format %d, interleaved %v: header %+v", format, interleaved, got)
+			}
+			if !slices.Equal(got.Frames, frames) {
+				t.Errorf("format %d, interleaved %v: frames differ", format, interleaved)
+			}
+			if len(got.DigiDrums) != 2 || !slices.Equal(got.DigiDrums[0].Data, drums[0].Data) ||
+				!slices.Equal(got.DigiDrums[1].Data, drums[1].Data[:3]) {
+				t.Errorf("format %d, interleaved %v: digidrums %v", format, interleaved, got.DigiDrums)
+			}
+		}
+	}
+
+	for i, bad := range []*YmSong{
+		{Format: YM_V4, Frames: frames},
+		{Format: YM_V5},
+		{Format: YM_V5, Frames: frames, LoopFrame: len(frames)},
+		{Format: YM_V6, Frames: frames, DigiDrums: []DigiDrum{{Size: 8, Data: make([]YmU8, 4)}}},
+		{Format: YM_V6, Frames: frames, SongName: "a\x00b"},
+	} {
+		if _, err := EncodeYM(bad); err == nil {
+			t.Errorf("invalid song %d encoded", i)
+		}
+	}
+}
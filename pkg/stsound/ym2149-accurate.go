@@ -0,0 +1,151 @@
+package stsound
+
+// YmCore selects the emulation core of a CYm2149Ex
+type YmCore int
+
+const (
+	// CoreFast steps the generators once per output sample (default)
+	CoreFast YmCore = iota
+	// CoreAccurate runs the generators at the chip clock divided by 8 and
+	// decimates to the replay rate with a band-limited resampler
+	CoreAccurate
+)
+
+func (c YmCore) String() string {
+	switch c {
+	case CoreFast:
+		return "fast"
+	case CoreAccurate:
+		return "accurate"
+	}
+	return "unknown"
+}
+
+// accurateState holds the counters of the accurate core. Periods are read
+// from the registers at every tick, as the real chip does.
+type accurateState struct {
+	toneCounter  [3]int
+	toneOut      [3]YmU32 // 0 or 1
+	noiseCounter int
+	noiseRng     YmU32 // 17-bit LFSR
+	envCounter   int
+	envPos       int // 0..63 within the current phase, 32 steps per ramp
+	resampler    *resampler
+}
+
+// SetCore switches between the fast and the accurate core
+func (ym *CYm2149Ex) SetCore(core YmCore) {
+	if core != ym.core {
+		ym.core = core
+		ym.resetAccurate()
+	}
+}
+
+// GetCore returns the core in use
+func (ym *CYm2149Ex) GetCore() YmCore {
+	return ym.core
+}
+
+func (ym *CYm2149Ex) resetAccurate() {
+	a := &ym.accurate
+	a.toneCounter = [3]int{}
+	a.toneOut = [3]YmU32{}
+	a.noiseCounter = 0
+	a.noiseRng = 1
+	a.envCounter = 0
+	a.envPos = 0
+	if a.resampler != nil {
+		a.resampler.reset()
+	}
+}
+
+// accurateVoices is the accurate counterpart of fastVoices
+func (ym *CYm2149Ex) accurateVoices() (YmInt, YmInt, YmInt) {
+	a := &ym.accurate
+	if a.resampler == nil {
+		a.resampler = newResampler(float64(ym.internalClock)/8, float64(ym.replayFrequency))
+	}
+
+	// Les effets (digidrums, SID, sync-buzzer) restent cadencés à la fréquence de sortie
+	ym.sidVolumeCompute(0, &ym.volA)
+	ym.sidVolumeCompute(1, &ym.volB)
+	ym.sidVolumeCompute(2, &ym.volC)
+
+	ym.syncBuzzerPhase += ym.syncBuzzerStep
+	if (ym.syncBuzzerPhase & (1 << 31)) != 0 {
+		ym.envPhase = 0
+		a.envPos = 0
+		a.envCounter = 0
+		ym.syncBuzzerPhase &= 0x7fffffff
+	}
+
+	ym.specialEffect[0].SidPos += ym.specialEffect[0].SidStep
+	ym.specialEffect[1].SidPos += ym.specialEffect[1].SidStep
+	ym.specialEffect[2].SidPos += ym.specialEffect[2].SidStep
+
+	vol := a.resampler.next(ym.tick)
+	return vol[0] * ym.voiceLevel[0] >> 8,
+		vol[1] * ym.voiceLevel[1] >> 8,
+		vol[2] * ym.voiceLevel[2] >> 8
+}
+
+// tick advances the chip by 8 clock cycles and returns the output of each voice
+func (ym *CYm2149Ex) tick() [3]float64 {
+	a := &ym.accurate
+	r := &ym.registers
+
+	// Tone: the square wave toggles every "period" ticks
+	for voice := 0; voice < 3; voice++ {
+		period := int(r[voice*2+1]&15)<<8 | int(r[voice*2])
+		if period == 0 {
+			period = 1
+		}
+		a.toneCounter[voice]++
+		if a.toneCounter[voice] >= period {
+			a.toneCounter[voice] = 0
+			a.toneOut[voice] ^= 1
+		}
+	}
+
+	// Noise: 17-bit LFSR (bit 0 xor bit 3, on both chips) clocked at half the tick rate
+	noisePeriod := int(r[6] & 0x1f)
+	if noisePeriod == 0 {
+		noisePeriod = 1
+	}
+	a.noiseCounter++
+	if a.noiseCounter >= noisePeriod*2 {
+		a.noiseCounter = 0
+		bit := (a.noiseRng ^ (a.noiseRng >> 3)) & 1
+		a.noiseRng = (a.noiseRng >> 1) | (bit << 16)
+	}
+	noise := a.noiseRng & 1
+
+	// Envelope: one of 32 steps per "period" ticks, phase 1 loops
+	envPeriod := int(r[12])<<8 | int(r[11])
+	if envPeriod == 0 {
+		envPeriod = 1
+	}
+	a.envCounter++
+	if a.envCounter >= envPeriod {
+		a.envCounter = 0
+		a.envPos++
+		if a.envPos == 64 {
+			a.envPos = 0
+			ym.envPhase = 1
+		}
+	}
+	ym.volE = ym.volumeTable[ym.envData[ym.envShape][ym.envPhase][a.envPos]]
+
+	mixerT := [3]YmU32{ym.mixerTA, ym.mixerTB, ym.mixerTC}
+	mixerN := [3]YmU32{ym.mixerNA, ym.mixerNB, ym.mixerNC}
+	pVol := [3]*YmInt{ym.pVolA, ym.pVolB, ym.pVolC}
+
+	var vol [3]YmInt
+	for voice := 0; voice < 3; voice++ {
+		if (a.toneOut[voice]|mixerT[voice]) != 0 && (noise|mixerN[voice]) != 0 {
+			vol[voice] = *pVol[voice]
+		}
+	}
+	vol[0], vol[1], vol[2] = ym.mixVoices(vol[0], vol[1], vol[2])
+	return [3]float64{float64(vol[0]), float64(vol[1]), float64(vol[2])}
+}
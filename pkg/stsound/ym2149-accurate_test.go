@@ -0,0 +1,86 @@
+package stsound
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestAccurateHighTones(t *testing.T) {
+	// A 192kHz, les périodes 2 à 5 (62.5kHz à 25kHz) restent sous Nyquist :
+	// sur 1s, le nombre de fronts montants donne la fréquence
+	const hiRate = 192000
+	for period := 2; period <= 5; period++ {
+		tone := renderTone(t, CoreAccurate, hiRate, period)
+		rising := 0
+		for i := 1; i < len(tone); i++ {
+			if tone[i-1] < 0 && tone[i] >= 0 {
+				rising++
+			}
+		}
+		want := ATARI_CLOCK / (16 * period)
+		if math.Abs(float64(rising-want)) > 2 {
+			t.Errorf("period %d: %dHz, want %dHz", period, rising, want)
+		}
+	}
+
+	// Au-dessus de Nyquist, le tone est filtré au lieu de se replier comme
+	// avec le core rapide, qui coupe seulement les périodes 1 à 5
+	ref := rms(renderTone(t, CoreAccurate, 44100, 40))
+	for _, tc := range []struct {
+		rate, period int
+	}{
+		{hiRate, 1}, {44100, 1}, {44100, 3}, {44100, 5}, {22050, 6}, {22050, 8}, {22050, 10},
+	} {
+		if level := rms(renderTone(t, CoreAccurate, tc.rate, tc.period)) / ref; level > 0.02 {
+			t.Errorf("%dHz, period %d: %.3f of a 3kHz tone left, want < 0.02", tc.rate, tc.period, level)
+		}
+		if tc.period > 5 {
+			if level := rms(renderTone(t, CoreFast, tc.rate, tc.period)) / ref; level < 0.5 {
+				t.Errorf("%dHz, period %d: the fast core does not alias (%.3f)", tc.rate, tc.period, level)
+			}
+		}
+	}
+}
+
+func TestSetCore(t *testing.T) {
+	// Trois joueurs rapides, seul le dernier passe au core précis
+	data := voiceSong(t, 0)
+	var players [3]*CYmMusic
+	for i := range players {
+		players[i] = NewYmMusic(44100)
+		if err := players[i].LoadMemory(data); err != nil {
+			t.Fatal(err)
+		}
+		players[i].Play()
+	}
+	render := func(ym *CYmMusic) []YmSample {
+		buffer := make([]YmSample, 4410)
+		ym.Update(buffer, len(buffer))
+		return buffer
+	}
+	for _, ym := range players {
+		render(ym)
+	}
+
+	players[2].SetCore(CoreAccurate)
+	if got := players[1].ymChip.GetCore(); got != CoreFast {
+		t.Errorf("player switched to %s with another one", got)
+	}
+	if got := players[2].ymChip.GetCore(); got != CoreAccurate {
+		t.Errorf("player on %s, want accurate", got)
+	}
+	ref := render(players[0])
+	if !slices.Equal(render(players[1]), ref) {
+		t.Error("the fast player changed its output")
+	}
+	if slices.Equal(render(players[2]), ref) {
+		t.Error("the accurate core renders like the fast one")
+	}
+
+	// Retour au core rapide
+	players[2].SetCore(CoreFast)
+	if got := players[2].ymChip.GetCore(); got != CoreFast {
+		t.Errorf("player on %s, want fast", got)
+	}
+}
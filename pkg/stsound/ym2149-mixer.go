@@ -0,0 +1,161 @@
+package stsound
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MixModel selects how the three voice outputs are summed
+type MixModel int
+
+const (
+	// MixLinear adds the three voices (original ST-Sound behaviour, default)
+	MixLinear MixModel = iota
+	// MixMeasured reads the summed level from a 3-D table measured on a real
+	// chip, given to SetMixTable: chords come out quieter than the sum of
+	// their notes. Without a table, the voices are mixed linearly.
+	MixMeasured
+)
+
+func (m MixModel) String() string {
+	switch m {
+	case MixLinear:
+		return "linear"
+	case MixMeasured:
+		return "measured"
+	}
+	return "unknown"
+}
+
+// ParseMixModel accepts "linear" or "measured"
+func ParseMixModel(s string) (MixModel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "linear":
+		return MixLinear, nil
+	case "measured":
+		return MixMeasured, nil
+	}
+	return MixLinear, fmt.Errorf("unknown mix model %q: expected linear or measured", s)
+}
+
+// MixTable is the output level of a chip measured for every combination of
+// the fixed volumes of its three voices, indexed by a<<8|b<<4|c: the layout
+// of the 16x16x16 tables measured on the Atari ST for other emulators. No
+// table is distributed with the player.
+type MixTable [16 * 16 * 16]uint16
+
+// ParseMixTable reads the 4096 levels of a MixTable: decimal or 0x
+// hexadecimal numbers separated by commas or blanks, as in a C array whose
+// declaration, up to the opening brace, is skipped. Lines starting with //
+// or # are skipped too.
+func ParseMixTable(r io.Reader) (*MixTable, error) {
+	table := new(MixTable)
+	n := 0
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "//") || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if i := strings.LastIndexByte(text, '{'); i >= 0 {
+			text = text[i+1:]
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == '}' || r == ';' || r == ' ' || r == '\t'
+		})
+		for _, field := range fields {
+			v, err := strconv.ParseUint(field, 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("mix table, line %d: %q is not a level", line, field)
+			}
+			if n == len(table) {
+				return nil, fmt.Errorf("mix table, line %d: more than %d levels", line, len(table))
+			}
+			table[n] = uint16(v)
+			n++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if n != len(table) {
+		return nil, fmt.Errorf("mix table: %d levels, want %d", n, len(table))
+	}
+	if table[15<<8] <= table[0] {
+		return nil, fmt.Errorf("mix table: voice A at full volume is not above silence")
+	}
+	return table, nil
+}
+
+// SetMixModel selects the linear (default) or the measured mix
+func (ym *CYm2149Ex) SetMixModel(model MixModel) {
+	ym.mixModel = model
+}
+
+// GetMixModel returns the mix model in use
+func (ym *CYm2149Ex) GetMixModel() MixModel {
+	return ym.mixModel
+}
+
+// SetMixTable sets the measured table of MixMeasured, nil to remove it. The
+// levels are scaled to the volume tables, which all end at
+// ymVolumeTable[15]: one voice at full volume gives the same level as the
+// linear mix.
+func (ym *CYm2149Ex) SetMixTable(table *MixTable) {
+	ym.mixTable = nil
+	if table == nil {
+		return
+	}
+	zero := int64(table[0])
+	full := int64(table[15<<8]) - zero
+	levels := new([len(table)]YmInt)
+	for i, level := range table {
+		levels[i] = YmInt((int64(level) - zero) * int64(ymVolumeTable[15]) / full)
+	}
+	ym.mixTable = levels
+}
+
+// mixVoices applies the measured mix to the three voice outputs. Chaque voix
+// est pondérée par le rapport entre le niveau mesuré et la somme linéaire,
+// ce qui garde la stéréo et les pistes séparées cohérentes avec le mix.
+func (ym *CYm2149Ex) mixVoices(volA, volB, volC YmInt) (YmInt, YmInt, YmInt) {
+	if ym.mixModel != MixMeasured || ym.mixTable == nil {
+		return volA, volB, volC
+	}
+
+	linear := volA + volB + volC
+	if linear <= 0 {
+		return volA, volB, volC
+	}
+	// La table est mesurée sur les volumes fixes : niveau d'enveloppe / 2
+	a, b, c := ym.volumeLevel(volA)>>1, ym.volumeLevel(volB)>>1, ym.volumeLevel(volC)>>1
+	mixed := ym.mixTable[a<<8|b<<4|c]
+	return volA * mixed / linear, volB * mixed / linear, volC * mixed / linear
+}
+
+// volumeLevel returns the envelope level (0..31) closest to a voice output.
+// Les digidrums et le niveau 0 ne tombent pas forcément sur la table. Entre
+// deux niveaux égaux (tables de 16 volumes), le niveau impair est celui du
+// volume fixe.
+func (ym *CYm2149Ex) volumeLevel(vol YmInt) int {
+	if vol <= 0 {
+		return 0
+	}
+	// Premier niveau au-dessus de vol
+	lo, hi := 0, len(ym.volumeTable)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if ym.volumeTable[mid] <= vol {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == len(ym.volumeTable) || (lo > 0 && vol-ym.volumeTable[lo-1] <= ym.volumeTable[lo]-vol) {
+		lo--
+	}
+	return lo
+}
@@ -0,0 +1,102 @@
+package stsound
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMixMeasured(t *testing.T) {
+	// Le texte d'un tableau C redonne la table
+	table := compressedMixTable()
+	var text strings.Builder
+	text.WriteString("// mesures\nstatic const unsigned short mix[4096] = {\n")
+	for i, level := range table {
+		if i%2 == 0 {
+			fmt.Fprintf(&text, "%d, ", level)
+		} else {
+			fmt.Fprintf(&text, "0x%04X,\n", level)
+		}
+	}
+	text.WriteString("};\n")
+	parsed, err := ParseMixTable(strings.NewReader(text.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != *table {
+		t.Fatal("ParseMixTable does not read back the table")
+	}
+
+	for _, chip := range []ChipModel{ChipYM2149, ChipAY8910} {
+		for _, core := range []YmCore{CoreFast, CoreAccurate} {
+			render := func(data []byte, mix MixModel, table *MixTable) []YmSample {
+				tracks := renderTracks(t, data, func(ym *CYmMusic) {
+					ym.SetChipModel(chip)
+					ym.SetCore(core)
+					ym.SetMixModel(mix)
+					ym.SetMixTable(table)
+				})
+				out := make([]YmSample, len(tracks[0]))
+				for i := range out {
+					out[i] = tracks[0][i] + tracks[1][i] + tracks[2][i]
+				}
+				return out
+			}
+
+			// Une voix seule au volume maximal garde son niveau
+			ym := NewYm2149ExWithModel(chip, ATARI_CLOCK, 1, 44100)
+			ym.SetCore(core)
+			ym.SetMixModel(MixMeasured)
+			ym.SetMixTable(table)
+			full := ym.fixedVolume(15)
+			for voice := 0; voice < 3; voice++ {
+				var vol [3]YmInt
+				vol[voice] = full
+				if a, b, c := ym.mixVoices(vol[0], vol[1], vol[2]); [3]YmInt{a, b, c} != vol {
+					t.Errorf("%s/%s: voice %c alone mixed to %d %d %d", chip, core, 'A'+voice, a, b, c)
+				}
+			}
+
+			// L'accord est plus faible que la somme de ses notes ; sans table,
+			// le mix reste linéaire
+			chord := mixSong(t, 0, 1, 2)
+			linear := render(chord, MixLinear, table)
+			if measured := render(chord, MixMeasured, table); slices.Max(measured) >= slices.Max(linear) {
+				t.Errorf("%s/%s: chord peaks at %d, not below the linear %d",
+					chip, core, slices.Max(measured), slices.Max(linear))
+			}
+			if !slices.Equal(render(chord, MixMeasured, nil), linear) {
+				t.Errorf("%s/%s: the measured mix without a table is not linear", chip, core)
+			}
+		}
+	}
+}
+
+func TestParseMixTable(t *testing.T) {
+	levels := func(n int, level string) string {
+		return strings.Repeat(level+",", n)
+	}
+	for name, text := range map[string]string{
+		"short":     levels(4095, "1"),
+		"long":      levels(4097, "1"),
+		"not level": "1, x, " + levels(4094, "1"),
+		"too large": "70000, " + levels(4095, "1"),
+		"flat":      levels(4096, "7"),
+	} {
+		if _, err := ParseMixTable(strings.NewReader(text)); err == nil {
+			t.Errorf("%s table accepted", name)
+		}
+	}
+}
+
+func TestParseMixModel(t *testing.T) {
+	for name, want := range map[string]MixModel{"linear": MixLinear, " Measured ": MixMeasured} {
+		if got, err := ParseMixModel(name); err != nil || got != want {
+			t.Errorf("ParseMixModel(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseMixModel("nonlinear"); err == nil {
+		t.Error(`ParseMixModel("nonlinear") succeeded`)
+	}
+}
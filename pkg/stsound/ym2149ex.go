@@ -1,5 +1,7 @@
 package stsound
 
+import "math"
+
 // Envelope shapes
 var (
 	env00xx = []YmInt{1, 0, 0, 0, 0, 0, 0, 0}
@@ -20,15 +22,27 @@ var (
 		env1100, env1101, env1110, env1111,
 	}
 
-	// Volume table - valeurs originales du YM2149
-	ymVolumeTable = []YmInt{
+	// Volume table - valeurs originales du YM2149, divisées par 3 comme dans
+	// l'original pour que la somme des trois voix tienne sur 16 bits.
+	// Calculée une fois pour toutes : les instances ne la modifient jamais.
+	ymVolumeTable = scaleVolumeTable([16]YmInt{
 		62, 161, 265, 377, 580, 774, 1155, 1575,
 		2260, 3088, 4570, 6233, 9330, 13187, 21220, 32767,
-	}
+	})
 
-	volumeTableInitialized = false
+	// Sinus-SID volume table: 16 volumes, 32 steps per sine period
+	sidSinTable = initSidSinTable()
 )
 
+const SIDSIN_STEPS = 32
+
+func scaleVolumeTable(table [16]YmInt) [16]YmInt {
+	for i := range table {
+		table[i] = (table[i] * 2) / 6
+	}
+	return table
+}
+
 const DC_ADJUST_BUFFERLEN = 512
 
 // DcAdjuster for DC offset adjustment
@@ -92,38 +106,63 @@ type CYm2149Ex struct {
 	envPos   YmU32
 	envPhase YmInt
 	envShape YmInt
-	envData  [16][2][32]YmU8  // 16 shapes, 2 phases (pas 4!), 32 steps
+	envData  [16][2][64]YmU8 // 16 shapes, 2 phases of 2 ramps, levels 0..31
 
 	// Special effects
 	specialEffect [3]YmSpecialEffect
+	sidSinStopped [3]YmBool // Sinus-SID running when SidStop was last called
 	bSyncBuzzer   YmBool
 	syncBuzzerStep YmU32
 	syncBuzzerPhase YmU32
 
-	// Filters
-	lowPassFilter [2]int
-	dcAdjust      *DcAdjuster
+	// Output filter chain (see filter.go): mono or left, right, and one per voice
+	filterStages []FilterStage
+	filters      FilterChain
+	filtersR     FilterChain
+	trackFilters [3]FilterChain
+
+	// Stereo: gains gauche/droite par voix (1/256)
+	panGain [3][2]YmInt
+
+	// Voice control: mute, solo and volume (1/256) of each voice
+	voiceMute   [3]YmBool
+	voiceSolo   [3]YmBool
+	voiceVolume [3]YmInt
+	voiceLevel  [3]YmInt // Resulting gain applied in computeVoices
+
+	// Chip model (see chip-model.go)
+	chipModel   ChipModel
+	volumeTable [32]YmInt // Envelope levels, fixed volume v is level 2v+1
+
+	// Mix model (see ym2149-mixer.go)
+	mixModel MixModel
+	mixTable *[16 * 16 * 16]YmInt // Scaled levels of SetMixTable, nil if none
+
+	// Accurate core (see ym2149-accurate.go)
+	core     YmCore
+	accurate accurateState
 }
 
 // NewYm2149Ex creates a new YM2149 emulator
 func NewYm2149Ex(masterClock YmU32, prediv YmInt, playRate YmU32) *CYm2149Ex {
+	return NewYm2149ExWithModel(ChipYM2149, masterClock, prediv, playRate)
+}
+
+// NewYm2149ExWithModel creates an emulator of the given chip model
+func NewYm2149ExWithModel(model ChipModel, masterClock YmU32, prediv YmInt, playRate YmU32) *CYm2149Ex {
 	ym := &CYm2149Ex{
 		bFilter:         YmTrue,
 		internalClock:   masterClock / YmU32(prediv),
 		replayFrequency: YmInt(playRate),
-		dcAdjust:        NewDcAdjuster(),
-	}
-
-	// Restaurer la division par 6 comme dans l'original
-	if !volumeTableInitialized && ymVolumeTable[15] == 32767 {
-		volumeTableInitialized = true
-		for i := range ymVolumeTable {
-			ymVolumeTable[i] = (ymVolumeTable[i] * 2) / 6
-		}
+		voiceVolume:     [3]YmInt{256, 256, 256},
 	}
+	ym.SetFilterChain(DefaultFilterStages(true))
+	ym.updateVoiceLevels()
 
 	// Build envelope shapes
 	ym.initEnvelopeData()
+	ym.SetChipModel(model)
+	ym.SetPanning(StereoABC.Pans())
 
 	// Set volume voice pointers
 	ym.pVolA = &ym.volA
@@ -136,39 +175,37 @@ func NewYm2149Ex(masterClock YmU32, prediv YmInt, playRate YmU32) *CYm2149Ex {
 	return ym
 }
 
+// initEnvelopeData builds the 16 shapes. Chaque phase contient deux rampes
+// de 32 pas (comme le C++, où les 4 rampes se suivent en mémoire) ;
+// la phase 1 boucle indéfiniment.
 func (ym *CYm2149Ex) initEnvelopeData() {
-	// Exactement comme dans le C++
 	for env := 0; env < 16; env++ {
 		pse := envWave[env]
-		pEnv := 0
-		for phase := 0; phase < 4; phase++ {
-			a := pse[phase*2]
-			b := pse[phase*2+1]
-			d := b - a
-			a *= 15
-			for i := 0; i < 16; i++ {
-				val := a
-				a += d
-				if val < 0 {
-					val = 0
-				} else if val > 15 {
-					val = 15
-				}
-				// Phase 0 et 1 seulement (le C++ utilise 2 phases avec 32 positions)
-				if phase < 2 {
-					ym.envData[env][phase][pEnv] = YmU8(val)
-					pEnv++
-				}
-			}
-			if phase == 1 {
-				pEnv = 0  // Reset pour la phase suivante
+		for ramp := 0; ramp < 4; ramp++ {
+			a := pse[ramp*2]
+			d := pse[ramp*2+1] - a
+			for i := 0; i < 32; i++ {
+				ym.envData[env][ramp/2][(ramp%2)*32+i] = YmU8(a*31 + d*YmInt(i))
 			}
 		}
 	}
 }
 
+func initSidSinTable() [16][SIDSIN_STEPS]YmU8 {
+	var tab [16][SIDSIN_STEPS]YmU8
+	for vol := 0; vol < 16; vol++ {
+		for i := 0; i < SIDSIN_STEPS; i++ {
+			// Le volume oscille entre (1-SIDSINPOWER)*vol et vol
+			s := 0.5 + 0.5*math.Sin(2*math.Pi*float64(i)/SIDSIN_STEPS)
+			tab[vol][i] = YmU8(math.Round(float64(vol) * (1 - SIDSINPOWER + SIDSINPOWER*s)))
+		}
+	}
+	return tab
+}
+
 func (ym *CYm2149Ex) SetClock(clock YmU32) {
 	ym.internalClock = clock
+	ym.accurate.resampler = nil
 }
 
 func (ym *CYm2149Ex) toneStepCompute(rHigh, rLow YmU8) YmU32 {
@@ -240,16 +277,20 @@ func (ym *CYm2149Ex) Reset() {
 	ym.envPhase = 0
 	ym.envPos = 0
 
-	ym.dcAdjust.Reset()
+	ym.filters.Reset()
+	ym.filtersR.Reset()
+	for _, chain := range ym.trackFilters {
+		chain.Reset()
+	}
 
 	for i := range ym.specialEffect {
 		ym.specialEffect[i] = YmSpecialEffect{}
+		ym.sidSinStopped[i] = YmFalse
 	}
 
 	ym.SyncBuzzerStop()
 
-	ym.lowPassFilter[0] = 0
-	ym.lowPassFilter[1] = 0
+	ym.resetAccurate()
 }
 
 func (ym *CYm2149Ex) sidVolumeCompute(voice YmInt, pVol *YmInt) {
@@ -261,6 +302,8 @@ func (ym *CYm2149Ex) sidVolumeCompute(voice YmInt, pVol *YmInt) {
 		} else {
 			ym.WriteRegister(8+voice, 0)
 		}
+	} else if pVoice.SidSin {
+		ym.WriteRegister(8+voice, YmInt(sidSinTable[pVoice.SidVol][pVoice.SidPos>>(32-5)]))
 	} else if pVoice.Drum {
 		// DigiDrum playback - exact formula from original
 		*pVol = YmInt((YmInt(pVoice.DrumData[pVoice.DrumPos>>DRUM_PREC]) * 255) / 6)
@@ -287,14 +330,51 @@ func (ym *CYm2149Ex) sidVolumeCompute(voice YmInt, pVol *YmInt) {
 	}
 }
 
-func (ym *CYm2149Ex) LowPassFilter(in int) int {
-	out := (ym.lowPassFilter[0] >> 2) + (ym.lowPassFilter[1] >> 1) + (in >> 2)
-	ym.lowPassFilter[0] = ym.lowPassFilter[1]
-	ym.lowPassFilter[1] = in
+func lowPass(state *[2]int, in int) int {
+	out := (state[0] >> 2) + (state[1] >> 1) + (in >> 2)
+	state[0] = state[1]
+	state[1] = in
 	return out
 }
 
 func (ym *CYm2149Ex) nextSample() YmSample {
+	volA, volB, volC := ym.computeVoices()
+	return ym.mixSample(volA + volB + volC)
+}
+
+func (ym *CYm2149Ex) mixSample(vol YmInt) YmSample {
+	return YmSample(ym.filters.Process(vol))
+}
+
+// nextStereoSample mixes the three voices with their pan gains
+func (ym *CYm2149Ex) nextStereoSample() (YmSample, YmSample) {
+	volA, volB, volC := ym.computeVoices()
+	left := (volA*ym.panGain[0][0] + volB*ym.panGain[1][0] + volC*ym.panGain[2][0]) >> 8
+	right := (volA*ym.panGain[0][1] + volB*ym.panGain[1][1] + volC*ym.panGain[2][1]) >> 8
+	return YmSample(ym.filters.Process(left)), YmSample(ym.filtersR.Process(right))
+}
+
+// nextMultitrackSample returns the mono mix and each voice filtered on its own.
+// Les filtres étant linéaires, la somme des trois voix redonne le mix.
+func (ym *CYm2149Ex) nextMultitrackSample() (YmSample, [3]YmSample) {
+	var tracks [3]YmSample
+	volA, volB, volC := ym.computeVoices()
+	for voice, vol := range [3]YmInt{volA, volB, volC} {
+		tracks[voice] = YmSample(ym.trackFilters[voice].Process(vol))
+	}
+	return ym.mixSample(volA + volB + volC), tracks
+}
+
+// computeVoices advances the generators by one sample and returns the level of each voice
+func (ym *CYm2149Ex) computeVoices() (YmInt, YmInt, YmInt) {
+	if ym.core == CoreAccurate {
+		return ym.accurateVoices()
+	}
+	return ym.fastVoices()
+}
+
+// fastVoices steps the counters once per output sample (original ST-Sound core)
+func (ym *CYm2149Ex) fastVoices() (YmInt, YmInt, YmInt) {
 	// Update noise generator
 	if (ym.noisePos & 0xffff0000) != 0 {
 		ym.currentNoise ^= ym.rndCompute()
@@ -303,7 +383,7 @@ func (ym *CYm2149Ex) nextSample() YmSample {
 	bn := ym.currentNoise
 
 	// Update envelope
-	ym.volE = ymVolumeTable[ym.envData[ym.envShape][ym.envPhase][ym.envPos>>(32-5)]]
+	ym.volE = ym.volumeTable[ym.envData[ym.envShape][ym.envPhase][ym.envPos>>(32-6)]]
 
 	// Update special effects
 	ym.sidVolumeCompute(0, &ym.volA)
@@ -323,7 +403,10 @@ func (ym *CYm2149Ex) nextSample() YmSample {
 	bt = (signC | ym.mixerTC) & (bn | ym.mixerNC)
 	volC := YmInt(*ym.pVolC) & YmInt(bt)
 
-	vol := volA + volB + volC
+	volA, volB, volC = ym.mixVoices(volA, volB, volC)
+	volA = volA * ym.voiceLevel[0] >> 8
+	volB = volB * ym.voiceLevel[1] >> 8
+	volC = volC * ym.voiceLevel[2] >> 8
 
 	// Inc
 	ym.posA += ym.stepA
@@ -351,14 +434,7 @@ func (ym *CYm2149Ex) nextSample() YmSample {
 	ym.specialEffect[1].SidPos += ym.specialEffect[1].SidStep
 	ym.specialEffect[2].SidPos += ym.specialEffect[2].SidStep
 
-	// Normalize process
-	ym.dcAdjust.AddSample(vol)
-	in := vol - ym.dcAdjust.GetDcLevel()
-
-	if ym.bFilter {
-		return YmSample(ym.LowPassFilter(int(in)))
-	}
-	return YmSample(in)
+	return volA, volB, volC
 }
 
 func (ym *CYm2149Ex) ReadRegister(reg YmInt) YmInt {
@@ -455,7 +531,7 @@ func (ym *CYm2149Ex) WriteRegister(reg, data YmInt) {
 
 	case 8:
 		ym.registers[8] = YmU8(data & 31)
-		ym.volA = ymVolumeTable[data&15]
+		ym.volA = ym.fixedVolume(data)
 		if (data & 0x10) != 0 {
 			ym.pVolA = &ym.volE
 		} else {
@@ -464,7 +540,7 @@ func (ym *CYm2149Ex) WriteRegister(reg, data YmInt) {
 
 	case 9:
 		ym.registers[9] = YmU8(data & 31)
-		ym.volB = ymVolumeTable[data&15]
+		ym.volB = ym.fixedVolume(data)
 		if (data & 0x10) != 0 {
 			ym.pVolB = &ym.volE
 		} else {
@@ -473,7 +549,7 @@ func (ym *CYm2149Ex) WriteRegister(reg, data YmInt) {
 
 	case 10:
 		ym.registers[10] = YmU8(data & 31)
-		ym.volC = ymVolumeTable[data&15]
+		ym.volC = ym.fixedVolume(data)
 		if (data & 0x10) != 0 {
 			ym.pVolC = &ym.volE
 		} else {
@@ -493,6 +569,8 @@ func (ym *CYm2149Ex) WriteRegister(reg, data YmInt) {
 		ym.envPos = 0
 		ym.envPhase = 0
 		ym.envShape = data & 0xf
+		ym.accurate.envPos = 0
+		ym.accurate.envCounter = 0
 	}
 }
 
@@ -502,6 +580,79 @@ func (ym *CYm2149Ex) Update(pSampleBuffer []YmSample, nbSample YmInt) {
 	}
 }
 
+// UpdateStereo renders nbSample interleaved left/right pairs
+func (ym *CYm2149Ex) UpdateStereo(pSampleBuffer []YmSample, nbSample YmInt) {
+	for i := YmInt(0); i < nbSample; i++ {
+		pSampleBuffer[2*i], pSampleBuffer[2*i+1] = ym.nextStereoSample()
+	}
+}
+
+// UpdateMultitrack renders nbSample samples of each voice into pTracks,
+// and of the mix into pMix
+func (ym *CYm2149Ex) UpdateMultitrack(pTracks [3][]YmSample, pMix []YmSample, nbSample YmInt) {
+	for i := YmInt(0); i < nbSample; i++ {
+		var tracks [3]YmSample
+		pMix[i], tracks = ym.nextMultitrackSample()
+		pTracks[0][i] = tracks[0]
+		pTracks[1][i] = tracks[1]
+		pTracks[2][i] = tracks[2]
+	}
+}
+
+// SetPanning places voices A, B and C in the stereo field (0 left, 1 right)
+func (ym *CYm2149Ex) SetPanning(pans [3]float64) {
+	for voice, pan := range pans {
+		ym.panGain[voice] = panGains(pan)
+	}
+}
+
+// SetVoiceMute silences a voice (VOICE_A, VOICE_B or VOICE_C), digidrums
+// and SID effects played on it included
+func (ym *CYm2149Ex) SetVoiceMute(voice YmInt, bMute YmBool) {
+	if voice >= 0 && voice < 3 {
+		ym.voiceMute[voice] = bMute
+		ym.updateVoiceLevels()
+	}
+}
+
+// SetVoiceSolo plays only the soloed voices while at least one is soloed.
+// Solo overrides mute: a soloed voice plays even when muted.
+func (ym *CYm2149Ex) SetVoiceSolo(voice YmInt, bSolo YmBool) {
+	if voice >= 0 && voice < 3 {
+		ym.voiceSolo[voice] = bSolo
+		ym.updateVoiceLevels()
+	}
+}
+
+// SetVoiceVolume scales a voice: 0 is silent, 1 unchanged, up to 2
+func (ym *CYm2149Ex) SetVoiceVolume(voice YmInt, volume float64) {
+	if voice < 0 || voice >= 3 {
+		return
+	}
+	if volume < 0 {
+		volume = 0
+	} else if volume > 2 {
+		volume = 2
+	}
+	ym.voiceVolume[voice] = YmInt(volume*256 + 0.5)
+	ym.updateVoiceLevels()
+}
+
+func (ym *CYm2149Ex) updateVoiceLevels() {
+	solo := ym.voiceSolo[0] || ym.voiceSolo[1] || ym.voiceSolo[2]
+	for voice := range ym.voiceLevel {
+		silent := ym.voiceMute[voice]
+		if solo {
+			silent = !ym.voiceSolo[voice]
+		}
+		if silent {
+			ym.voiceLevel[voice] = 0
+		} else {
+			ym.voiceLevel[voice] = ym.voiceVolume[voice]
+		}
+	}
+}
+
 func (ym *CYm2149Ex) DrumStart(voice YmInt, pDrumBuffer []YmU8, drumSize YmU32, drumFreq YmInt) {
 	if len(pDrumBuffer) > 0 && drumSize > 0 {
 		ym.specialEffect[voice].DrumData = pDrumBuffer
@@ -525,7 +676,31 @@ func (ym *CYm2149Ex) SidStart(voice, timerFreq, vol YmInt) {
 }
 
 func (ym *CYm2149Ex) SidStop(voice YmInt) {
+	// Le player arrête les effets à chaque frame : un Sinus-SID relancé
+	// juste après garde sa phase
+	ym.sidSinStopped[voice] = ym.specialEffect[voice].SidSin
+	ym.specialEffect[voice].Sid = YmFalse
+	ym.specialEffect[voice].SidSin = YmFalse
+}
+
+// SidSinStart sweeps the voice volume through a sine table, one step per timer
+// tick. The sine keeps its phase when it was already running on the voice,
+// or was only stopped by SidStop since.
+func (ym *CYm2149Ex) SidSinStart(voice, timerFreq, vol YmInt) {
+	tmp := YmS64(timerFreq) << (32 - 5)
+	tmp /= YmS64(ym.replayFrequency)
+	ym.specialEffect[voice].SidStep = YmU32(tmp)
+	if !ym.specialEffect[voice].SidSin && !ym.sidSinStopped[voice] {
+		ym.specialEffect[voice].SidPos = 0
+	}
+	ym.specialEffect[voice].SidVol = vol & 15
 	ym.specialEffect[voice].Sid = YmFalse
+	ym.specialEffect[voice].SidSin = YmTrue
+}
+
+func (ym *CYm2149Ex) SidSinStop(voice YmInt) {
+	ym.specialEffect[voice].SidSin = YmFalse
+	ym.sidSinStopped[voice] = YmFalse
 }
 
 func (ym *CYm2149Ex) SyncBuzzerStart(timerFreq, envShape YmInt) {
@@ -542,6 +717,30 @@ func (ym *CYm2149Ex) SyncBuzzerStop() {
 	ym.syncBuzzerStep = 0
 }
 
+// fixedVolume returns the level of volume register value v (0..15)
+func (ym *CYm2149Ex) fixedVolume(v YmInt) YmInt {
+	return ym.volumeTable[(v&15)*2+1]
+}
+
+// SetFilter selects the original chain, with or without the 3-tap low-pass
 func (ym *CYm2149Ex) SetFilter(bFilter YmBool) {
 	ym.bFilter = bFilter
+	ym.SetFilterChain(DefaultFilterStages(bool(bFilter)))
+}
+
+// SetFilterChain replaces the output filter chain, an empty chain leaves
+// the chip output untouched. Stages unchanged at the same position keep their state.
+func (ym *CYm2149Ex) SetFilterChain(stages []FilterStage) {
+	rate := int(ym.replayFrequency)
+	ym.filters = rebuildFilterChain(ym.filters, ym.filterStages, stages, rate)
+	ym.filtersR = rebuildFilterChain(ym.filtersR, ym.filterStages, stages, rate)
+	for i := range ym.trackFilters {
+		ym.trackFilters[i] = rebuildFilterChain(ym.trackFilters[i], ym.filterStages, stages, rate)
+	}
+	ym.filterStages = append([]FilterStage(nil), stages...)
+}
+
+// GetFilterChain returns the stages of the output filter chain
+func (ym *CYm2149Ex) GetFilterChain() []FilterStage {
+	return append([]FilterStage(nil), ym.filterStages...)
 }
\ No newline at end of file
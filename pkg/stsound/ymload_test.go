@@ -0,0 +1,208 @@
+package stsound
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadSeeds(t *testing.T) {
+	for i, seed := range fuzzSeeds(t) {
+		ym := NewYmMusic(44100)
+		if err := ym.LoadMemory(seed); err != nil {
+			t.Errorf("seed %d: %v", i, err)
+		}
+	}
+}
+
+func FuzzYmDecode(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+
+	// Aucun fichier, même malformé, ne doit faire paniquer le lecteur
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ym := NewYmMusic(44100)
+		if err := ym.LoadMemory(data); err != nil {
+			return
+		}
+
+		buffer := make([]YmSample, 2048)
+		ym.SetLoopMode(YmTrue)
+		ym.Play()
+		for i := 0; i < 8; i++ {
+			ym.Update(buffer, len(buffer))
+		}
+		ym.SetMusicTime(ym.GetMusicTime() / 2)
+		ym.Update(buffer, len(buffer))
+	})
+}
+
+func TestLoadMix(t *testing.T) {
+	samples := make([]byte, 160)
+	for i := range samples {
+		samples[i] = byte(i * 3)
+	}
+	// Ordre de lecture des échantillons : 0-79, 0-79, 80-159
+	var order []int
+	for _, block := range [][2]int{{0, 80}, {0, 80}, {80, 160}} {
+		for i := block[0]; i < block[1]; i++ {
+			order = append(order, i)
+		}
+	}
+
+	for _, signed := range []bool{false, true} {
+		attrib := uint32(0)
+		if signed {
+			attrib = A_DRUMSIGNED
+		}
+		want := func(i int) YmSample {
+			b := samples[order[i%len(order)]]
+			if !signed {
+				b ^= 0x80
+			}
+			return YmSample(int8(b)) << 8
+		}
+
+		// Au même débit que les blocs, chaque échantillon est rendu tel quel
+		ym := NewYmMusic(8000)
+		if err := ym.LoadMemory(mixFile(attrib, samples)); err != nil {
+			t.Fatal(err)
+		}
+		info := ym.GetMusicInfo()
+		if info.SongType != "MIX1" || info.SongName != "name" || info.SongComment != "comment" || info.MusicTimeInMs != 30 {
+			t.Errorf("info: %+v", info)
+		}
+
+		ym.SetLoopMode(YmTrue)
+		ym.Play()
+		buffer := make([]YmSample, 2*len(order)+10)
+		ym.Update(buffer, len(buffer))
+		for i, s := range buffer {
+			if s != want(i) {
+				t.Fatalf("signed %v: sample %d = %d, want %d", signed, i, s, want(i))
+			}
+		}
+
+		// Le seek passe par la table des temps : 20ms tombe au début du bloc 1
+		ym.SetMusicTime(20)
+		ym.Update(buffer, 1)
+		if buffer[0] != want(160) {
+			t.Errorf("signed %v: sample at 20ms = %d, want %d", signed, buffer[0], want(160))
+		}
+	}
+
+	// Sans boucle, le morceau s'arrête après le dernier bloc
+	ym := NewYmMusic(8000)
+	if err := ym.LoadMemory(mixFile(0, samples)); err != nil {
+		t.Fatal(err)
+	}
+	ym.Play()
+	buffer := make([]YmSample, len(order))
+	ym.Update(buffer, len(buffer))
+	if !ym.GetMusicOver() {
+		t.Error("song not over after its last block")
+	}
+
+	// Un bloc qui déborde du buffer d'échantillons est refusé
+	bad := mixFile(0, samples)
+	binary.BigEndian.PutUint32(bad[12+12+12:], 100)
+	if err := NewYmMusic(8000).LoadMemory(bad); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("block past the sample buffer: %v, want ErrInvalidHeader", err)
+	}
+}
+
+func TestLoadTracker(t *testing.T) {
+	drum := make([]byte, 600)
+	for i := range drum {
+		drum[i] = byte(i * 5)
+	}
+	// 8000Hz à 8000Hz : un octet par échantillon, volume 32 sur 64
+	const freqHigh, freqLow = 8000 >> 8, 8000 & 0xff
+	lines := [][4]byte{
+		{0, 32, freqHigh, freqLow},    // lance le sample 0
+		{5, 32, freqHigh, freqLow},    // sample 5 inexistant : le sample 0 continue
+		{0xff, 32, freqHigh, freqLow}, // pas de nouvelle note
+		{0, 32, freqHigh, freqLow},    // relance le sample 0
+	}
+	ym := NewYmMusic(8000)
+	if err := ym.LoadMemory(trackerFile(1, drum, lines)); err != nil {
+		t.Fatal(err)
+	}
+	if info := ym.GetMusicInfo(); info.SongType != "YM-T1" || info.SongAuthor != "author" {
+		t.Errorf("info: %+v", info)
+	}
+	ym.SetLoopMode(YmTrue)
+	ym.Play()
+
+	// 160 échantillons par frame, les frames 4 et 5 rejouent les lignes 1 et 2
+	buffer := make([]YmSample, 6*160)
+	ym.Update(buffer, len(buffer))
+	for i, s := range buffer {
+		// La frame 3 relance le sample, la boucle reprend la suite
+		pos := i % 480
+		if want := YmSample((int(drum[pos]) - 128) * 256 * 32 / 64); s != want {
+			t.Fatalf("sample %d = %d, want %d (drum byte %d)", i, s, want, pos)
+		}
+	}
+
+	// Sans boucle, le morceau s'arrête après sa dernière ligne
+	ym.SetLoopMode(YmFalse)
+	ym.Restart()
+	ym.Update(buffer, len(buffer))
+	if !ym.GetMusicOver() {
+		t.Error("song not over after its last line")
+	}
+}
+
+func TestLoadYM4(t *testing.T) {
+	frames := make([][16]byte, 50)
+	for i := range frames {
+		frames[i] = [16]byte{0: byte(i), 1: 1, 7: 0x3e, 8: 15, 10: byte(i % 16), 13: 0xff}
+	}
+	// Digidrum 0 sur la voix B à la frame 10, timer à 2457600/(4*20) Hz
+	frames[10][3], frames[10][8], frames[10][9], frames[10][15] = 0x20, 0x20|15, 0, 20
+	drum := []byte{0x80, 0xc0, 0xff, 0xc0, 0x80, 0x40, 0, 0x40}
+
+	ym := NewYmMusic(44100)
+	if err := ym.LoadMemory(ym4File(frames, 12, drum)); err != nil {
+		t.Fatal(err)
+	}
+	if info := ym.GetMusicInfo(); info.SongType != "YM 4" || info.SongName != "name" || info.MusicTimeInMs != 1000 {
+		t.Errorf("info: %+v", info)
+	}
+	song, err := ym.Song()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(song.Frames, frames) || song.LoopFrame != 12 {
+		t.Errorf("frames or loop frame differ: loop %d", song.LoopFrame)
+	}
+	if len(song.DigiDrums) != 1 || !slices.Equal(song.DigiDrums[0].Data, []YmU8{0x80, 0xc0, 0xff, 0xc0, 0x80, 0x40, 0, 0x40}) {
+		t.Errorf("digidrums: %v", song.DigiDrums)
+	}
+
+	var drums []int
+	ym.SubscribeFrames(func(e FrameEvent) {
+		if slices.Contains(e.Effects, Effect{EffectDigiDrum, 1, 30720}) {
+			drums = append(drums, e.Frame)
+		}
+	})
+	ym.Play()
+	buffer := make([]YmSample, 882*12)
+	ym.Update(buffer, len(buffer))
+	if !slices.Equal(drums, []int{10}) {
+		t.Errorf("digidrum played at frames %v, want [10]", drums)
+	}
+
+	// Fichier coupé dans la taille ou les données du digidrum
+	data := ym4File(frames, 12, drum)
+	for _, size := range []int{30, 34, 38} {
+		err := NewYmMusic(44100).LoadMemory(data[:size])
+		if !errors.Is(err, ErrTruncated) || !strings.Contains(err.Error(), "digidrum 0") {
+			t.Errorf("YM4 cut at %d bytes: %v, want ErrTruncated on digidrum 0", size, err)
+		}
+	}
+}
@@ -1,9 +1,18 @@
 package stsound
 
-// CYmMusic - Main YM music player class
+import (
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// CYmMusic - Main YM music player class. Its methods may be called from
+// several goroutines, every call holds the mutex.
 type CYmMusic struct {
+	mutex sync.Mutex
+
 	ymChip          *CYm2149Ex
-	lastError       string
+	lastError       error
 	songType        YmFileType
 	nbFrame         int
 	loopFrame       int
@@ -24,6 +33,34 @@ type CYmMusic struct {
 	replayRate      int
 	bMusicOver      YmBool
 
+	// Machine profile forced with SetMachine, and the header values it overrides
+	machine          *Machine
+	headerClock      YmU32
+	headerPlayerRate YmInt
+
+	// CRC-32 of the depacked file, identifies the song in snapshots
+	songCRC YmU32
+
+	// Seek (see seek.go): mode, output the state is rebuilt for, and the
+	// snapshots taken along the song by playback and the exact seeks. inexact
+	// is set while the state comes from a fast seek or a Restore.
+	seekMode      SeekMode
+	outputMode    outputMode
+	keyframes     []keyframe
+	keyframesMode outputMode
+	inexact       bool
+
+	// Loop policy (see loop-policy.go) and samples rendered since the start
+	loopPolicy    LoopPolicy
+	playedSamples int64
+
+	// Frame subscribers (see frame-events.go), effects started by the
+	// current frame and timer frequency of the last digidrum of each voice
+	subscribers    []frameSubscriber
+	nextSubscriber int
+	frameEffects   []Effect
+	drumEffects    [3]int
+
 	// Song information
 	pSongName    string
 	pSongAuthor  string
@@ -75,24 +112,167 @@ func NewYmMusic(replayRate int) *CYmMusic {
 
 // Public methods
 func (ym *CYmMusic) Load(fileName string) error {
-	return ym.load(fileName)
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.setLastError(ym.load(fileName))
 }
 
 func (ym *CYmMusic) LoadMemory(data []byte) error {
-	return ym.loadMemory(data)
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.setLastError(ym.loadMemory(data))
+}
+
+func (ym *CYmMusic) LoadReader(r io.Reader) error {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.setLastError(ym.loadReader(r))
+}
+
+func (ym *CYmMusic) LoadFS(fsys fs.FS, name string) error {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.setLastError(ym.loadFS(fsys, name))
 }
 
 func (ym *CYmMusic) UnLoad() {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
 	ym.unLoad()
 }
 
 func (ym *CYmMusic) IsSeekable() YmBool {
-	return (ym.attrib & A_TIMECONTROL) != 0
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.isSeekable()
 }
 
 func (ym *CYmMusic) Update(pBuffer []YmSample, nbSample int) YmBool {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.updateMono(pBuffer, nbSample)
+}
+
+// UpdateStereo renders nbSample interleaved left/right pairs into pBuffer
+// (2*nbSample values). MIX and tracker songs are rendered in mono on both sides.
+func (ym *CYmMusic) UpdateStereo(pBuffer []YmSample, nbSample int) YmBool {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.updateStereo(pBuffer, nbSample)
+}
+
+// UpdateMultitrack renders voices A, B and C into separate buffers, and the
+// mono mix into pMix (may be nil). MIX and tracker songs only fill pMix.
+func (ym *CYmMusic) UpdateMultitrack(pTracks [3][]YmSample, pMix []YmSample, nbSample int) YmBool {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.updateMultitrack(pTracks, pMix, nbSample)
+}
+
+func (ym *CYmMusic) updateMono(pBuffer []YmSample, nbSample int) YmBool {
+	ym.outputMode = outputMono
+	return ym.update(pBuffer, nbSample, 1, func(pos, nbs int) {
+		ym.ymChip.Update(pBuffer[pos:pos+nbs], YmInt(nbs))
+	})
+}
+
+func (ym *CYmMusic) updateStereo(pBuffer []YmSample, nbSample int) YmBool {
+	ym.outputMode = outputStereo
+	return ym.update(pBuffer, nbSample, 2, func(pos, nbs int) {
+		ym.ymChip.UpdateStereo(pBuffer[2*pos:2*(pos+nbs)], YmInt(nbs))
+	})
+}
+
+func (ym *CYmMusic) updateMultitrack(pTracks [3][]YmSample, pMix []YmSample, nbSample int) YmBool {
+	ym.outputMode = outputMultitrack
+	if pMix == nil {
+		pMix = make([]YmSample, nbSample)
+	}
+	for _, pTrack := range pTracks {
+		ym.bufferClear(pTrack, nbSample)
+	}
+
+	start := ym.playedSamples
+	ret := ym.update(pMix, nbSample, 1, func(pos, nbs int) {
+		tracks := [3][]YmSample{pTracks[0][pos:], pTracks[1][pos:], pTracks[2][pos:]}
+		ym.ymChip.UpdateMultitrack(tracks, pMix[pos:pos+nbs], YmInt(nbs))
+	})
+	if ym.playedSamples != start {
+		for _, pTrack := range pTracks {
+			ym.fadeOut(pTrack, nbSample, 1, start)
+		}
+	}
+	return ret
+}
+
+// SetPanning places voices A, B and C in the stereo field (0 left, 1 right)
+func (ym *CYmMusic) SetPanning(pans [3]float64) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.ymChip.SetPanning(pans)
+	ym.keyframes = nil
+}
+
+// SetCore selects the fast (default) or the accurate emulation core
+func (ym *CYmMusic) SetCore(core YmCore) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.ymChip.SetCore(core)
+	ym.keyframes = nil
+}
+
+// SetChipModel selects the YM2149 (default) or AY-3-8910 chip
+func (ym *CYmMusic) SetChipModel(model ChipModel) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.ymChip.SetChipModel(model)
+	ym.keyframes = nil
+}
+
+// SetMixModel selects the linear (default) or the measured voice mix
+func (ym *CYmMusic) SetMixModel(model MixModel) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.ymChip.SetMixModel(model)
+	ym.keyframes = nil
+}
+
+// SetMixTable sets the measured table of MixMeasured, nil to remove it
+func (ym *CYmMusic) SetMixTable(table *MixTable) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.ymChip.SetMixTable(table)
+	ym.keyframes = nil
+}
+
+// SetVoiceMute, SetVoiceSolo and SetVoiceVolume control the chip voices.
+// They have no effect on MIX and tracker songs.
+func (ym *CYmMusic) SetVoiceMute(voice int, bMute YmBool) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.ymChip.SetVoiceMute(YmInt(voice), bMute)
+	ym.keyframes = nil
+}
+
+func (ym *CYmMusic) SetVoiceSolo(voice int, bSolo YmBool) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.ymChip.SetVoiceSolo(YmInt(voice), bSolo)
+	ym.keyframes = nil
+}
+
+func (ym *CYmMusic) SetVoiceVolume(voice int, volume float64) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.ymChip.SetVoiceVolume(YmInt(voice), volume)
+	ym.keyframes = nil
+}
+
+// update runs the replay routine every VBL. pBuffer receives MIX and tracker
+// songs and the silence, chip output is left to render (sample position, count).
+func (ym *CYmMusic) update(pBuffer []YmSample, nbSample int, channels int, render func(pos, nbs int)) YmBool {
 	if !ym.bMusicOk || ym.bPause || ym.bMusicOver {
-		ym.bufferClear(pBuffer, nbSample)
+		ym.bufferClear(pBuffer, nbSample*channels)
 		if ym.bMusicOver {
 			return YmFalse
 		}
@@ -101,38 +281,63 @@ func (ym *CYmMusic) Update(pBuffer []YmSample, nbSample int) YmBool {
 
 	if ym.songType >= YM_MIX1 && ym.songType < YM_MIXMAX {
 		ym.stDigitMix(pBuffer, nbSample)
+		if channels == 2 {
+			monoToStereo(pBuffer, nbSample)
+		}
 	} else if ym.songType >= YM_TRACKER1 && ym.songType < YM_TRACKERMAX {
 		ym.ymTrackerUpdate(pBuffer, nbSample)
+		if channels == 2 {
+			monoToStereo(pBuffer, nbSample)
+		}
 	} else {
-		pOut := pBuffer
+		pos := 0
 		nbs := nbSample
-		vblNbSample := ym.replayRate / int(ym.playerRate)
+		vblNbSample := ym.vblNbSample()
 
+		// Le player écrit les registres d'une frame avant son premier
+		// échantillon : le rendu ne dépend pas de la taille des buffers
+		if ym.innerSamplePos >= vblNbSample {
+			ym.innerSamplePos = 0
+		}
 		for nbs > 0 {
+			if ym.innerSamplePos == 0 {
+				ym.frameKeyframe(ym.playedSamples + int64(pos))
+				ym.player()
+				ym.frameEvent(pos)
+			}
+
 			sampleToCompute := vblNbSample - ym.innerSamplePos
 			if sampleToCompute > nbs {
 				sampleToCompute = nbs
 			}
+			render(pos, sampleToCompute)
+			pos += sampleToCompute
+			nbs -= sampleToCompute
 
 			ym.innerSamplePos += sampleToCompute
 			if ym.innerSamplePos >= vblNbSample {
-				ym.player()
-				ym.innerSamplePos -= vblNbSample
+				ym.innerSamplePos = 0
 			}
-
-			if sampleToCompute > 0 {
-				ym.ymChip.Update(pOut[:sampleToCompute], YmInt(sampleToCompute))
-				pOut = pOut[sampleToCompute:]
-			}
-			nbs -= sampleToCompute
 		}
 	}
 
+	start := ym.playedSamples
+	ym.playedSamples += int64(nbSample)
+	ym.fadeOut(pBuffer, nbSample, channels, start)
+	if ym.policyOver() {
+		ym.bMusicOver = YmTrue
+	}
+
 	return YmTrue
 }
 
 func (ym *CYmMusic) GetPos() YmU32 {
-	if ym.songType >= YM_MIX1 && ym.songType < YM_MIXMAX {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+
+	if ym.hasLoopPolicy() {
+		return YmU32(ym.playedSamples * 1000 / int64(ym.replayRate))
+	} else if ym.songType >= YM_MIX1 && ym.songType < YM_MIXMAX {
 		return ym.iMusicPosInMs
 	} else if ym.nbFrame > 0 && ym.playerRate > 0 {
 		return YmU32(ym.currentFrame) * 1000 / YmU32(ym.playerRate)
@@ -141,86 +346,148 @@ func (ym *CYmMusic) GetPos() YmU32 {
 }
 
 func (ym *CYmMusic) GetMusicTime() YmU32 {
-	if ym.songType >= YM_MIX1 && ym.songType < YM_MIXMAX {
-		return ym.musicLenInMs
-	} else if ym.nbFrame > 0 && ym.playerRate > 0 {
-		return YmU32(ym.nbFrame) * 1000 / YmU32(ym.playerRate)
-	}
-	return 0
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.getMusicTime()
 }
 
 func (ym *CYmMusic) SetMusicTime(time YmU32) YmU32 {
-	if !ym.IsSeekable() {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	return ym.setMusicTime(time)
+}
+
+func (ym *CYmMusic) Restart() {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+
+	ym.setMusicTime(0)
+	ym.bMusicOver = YmFalse
+}
+
+// getMusicTime is the length of the song, or of the whole rendering under
+// a loop policy
+func (ym *CYmMusic) getMusicTime() YmU32 {
+	if ym.hasLoopPolicy() && ym.songTime() > 0 {
+		_, end := ym.policyTimes()
+		return end
+	}
+	return ym.songTime()
+}
+
+func (ym *CYmMusic) setMusicTime(time YmU32) YmU32 {
+	if !ym.isSeekable() {
 		return 0
 	}
 
 	newTime := time
 	if ym.songType >= YM_V2 && ym.songType < YM_VMAX {
-		if newTime >= ym.GetMusicTime() {
+		if newTime >= ym.getMusicTime() {
 			newTime = 0
 		}
-		ym.currentFrame = int(newTime * YmU32(ym.playerRate) / 1000)
+		ym.seekFrame(int(newTime * YmU32(ym.playerRate) / 1000))
 	} else if ym.songType >= YM_TRACKER1 && ym.songType < YM_TRACKERMAX {
-		if newTime >= ym.GetMusicTime() {
+		if newTime >= ym.getMusicTime() {
 			newTime = 0
 		}
-		ym.currentFrame = int(newTime * YmU32(ym.playerRate) / 1000)
+		ym.currentFrame = int(ym.passTime(newTime) * YmU32(ym.playerRate) / 1000)
+		ym.ymTrackerNbSampleBefore = 0
+		ym.playedSamples = int64(newTime) * int64(ym.replayRate) / 1000
 	} else if ym.songType >= YM_MIX1 && ym.songType < YM_MIXMAX {
-		ym.setMixTime(time)
+		ym.setMixTime(ym.passTime(time))
+		ym.playedSamples = int64(time) * int64(ym.replayRate) / 1000
 	}
 
 	return newTime
 }
 
-func (ym *CYmMusic) Restart() {
-	ym.SetMusicTime(0)
-	ym.bMusicOver = YmFalse
-}
-
 func (ym *CYmMusic) Play() {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
 	ym.play()
 }
 
 func (ym *CYmMusic) Pause() {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
 	ym.pause()
 }
 
 func (ym *CYmMusic) Stop() {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
 	ym.stop()
 }
 
 func (ym *CYmMusic) SetLoopMode(bLoop YmBool) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
 	ym.bLoop = bLoop
 }
 
 func (ym *CYmMusic) GetLastError() string {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+
+	if ym.lastError == nil {
+		return ""
+	}
+	return ym.lastError.Error()
+}
+
+// LastError returns the error of the last load, nil on success
+func (ym *CYmMusic) LastError() error {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
 	return ym.lastError
 }
 
 func (ym *CYmMusic) ReadYmRegister(reg int) int {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
 	return int(ym.ymChip.ReadRegister(YmInt(reg)))
 }
 
 func (ym *CYmMusic) SetLowpassFilter(bActive YmBool) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
 	ym.ymChip.SetFilter(bActive)
+	ym.keyframes = nil
+}
+
+// SetFilterChain replaces the output filter chain of the chip
+func (ym *CYmMusic) SetFilterChain(stages []FilterStage) {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+	ym.ymChip.SetFilterChain(stages)
+	ym.keyframes = nil
 }
 
 func (ym *CYmMusic) GetMusicInfo() *YmMusicInfo {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
+
 	return &YmMusicInfo{
 		SongName:      ym.pSongName,
 		SongAuthor:    ym.pSongAuthor,
 		SongComment:   ym.pSongComment,
 		SongType:      ym.pSongType,
 		SongPlayer:    ym.pSongPlayer,
-		MusicTimeInMs: ym.GetMusicTime(),
+		MusicTimeInMs: ym.getMusicTime(),
 	}
 }
 
 func (ym *CYmMusic) GetMusicOver() YmBool {
+	ym.mutex.Lock()
+	defer ym.mutex.Unlock()
 	return ym.bMusicOver
 }
 
 // Private methods
+func (ym *CYmMusic) isSeekable() YmBool {
+	return (ym.attrib & A_TIMECONTROL) != 0
+}
+
 func (ym *CYmMusic) setTimeControl(bTime YmBool) {
 	if bTime {
 		ym.attrib |= A_TIMECONTROL
@@ -237,8 +504,9 @@ func (ym *CYmMusic) setAttrib(attrib YmInt) {
 	ym.attrib = attrib
 }
 
-func (ym *CYmMusic) setLastError(err string) {
+func (ym *CYmMusic) setLastError(err error) error {
 	ym.lastError = err
+	return err
 }
 
 func (ym *CYmMusic) bufferClear(pBuffer []YmSample, nbSample int) {
@@ -262,7 +530,12 @@ func (ym *CYmMusic) unLoad() {
 	ym.pBigSampleBuffer = nil
 	ym.pMixBlock = nil
 	ym.pTimeInfo = nil
+	ym.keyframes = nil
+	ym.inexact = false
 	ym.nbDrum = 0
+	ym.nbMixBlock = 0
+	ym.nbTimeKey = 0
+	ym.musicLenInMs = 0
 }
 
 func (ym *CYmMusic) stop() {
@@ -271,6 +544,8 @@ func (ym *CYmMusic) stop() {
 	ym.iMusicPosInMs = 0
 	ym.iMusicPosAccurateSample = 0
 	ym.mixPos = -1
+	ym.ymTrackerNbSampleBefore = 0
+	ym.playedSamples = 0
 }
 
 func (ym *CYmMusic) play() {
@@ -283,12 +558,13 @@ func (ym *CYmMusic) pause() {
 
 // Player routine
 func (ym *CYmMusic) player() {
+	ym.frameEffects = ym.frameEffects[:0]
 	if ym.currentFrame < 0 {
 		ym.currentFrame = 0
 	}
 
 	if ym.currentFrame >= ym.nbFrame {
-		if ym.bLoop {
+		if ym.looping() {
 			ym.currentFrame = ym.loopFrame
 		} else {
 			ym.bMusicOver = YmTrue
@@ -330,6 +606,7 @@ func (ym *CYmMusic) player() {
 				sampleFrq := MFP_CLOCK / YmInt(data[12])
 				if int(sampleNum) < len(sampleAddress) {
 					ym.ymChip.DrumStart(2, sampleAddress[sampleNum], sampleLen[sampleNum], sampleFrq)
+					ym.startEffect(EffectDigiDrum, 2, sampleFrq)
 				}
 			}
 		}
@@ -340,12 +617,12 @@ func (ym *CYmMusic) player() {
 			ym.ymChip.WriteRegister(13, YmInt(data[13]))
 		}
 
-		if ym.songType >= YM_V5 {
+		if ym.songType >= YM_V4 {
 			if ym.songType == YM_V6 {
 				ym.readYm6Effect(data, 1, 6, 14)
 				ym.readYm6Effect(data, 3, 8, 15)
 			} else {
-				// YM5 effect decoding
+				// YM4/YM5 effect decoding
 				ym.readYm5Effects(data)
 			}
 		}
@@ -364,6 +641,7 @@ func (ym *CYmMusic) readYm5Effects(data []byte) {
 		if prediv != 0 {
 			tmpFreq := 2457600 / prediv
 			ym.ymChip.SidStart(YmInt(voice), tmpFreq, YmInt(data[voice+8]&15))
+			ym.startEffect(EffectSID, YmInt(voice), tmpFreq)
 		}
 	}
 
@@ -381,6 +659,7 @@ func (ym *CYmMusic) readYm5Effects(data []byte) {
 					ym.pDrumTab[ndrum].Data,
 					ym.pDrumTab[ndrum].Size,
 					sampleFrq)
+				ym.startEffect(EffectDigiDrum, YmInt(voice), sampleFrq)
 			}
 		}
 	}
@@ -402,8 +681,11 @@ func (ym *CYmMusic) readYm6Effect(pReg []byte, code, prediv, count int) {
 				tmpFreq := 2457600 / p
 				if (effectCode & 0xc0) == 0x00 {
 					ym.ymChip.SidStart(YmInt(voice), tmpFreq, YmInt(pReg[voice+8]&15))
+					ym.startEffect(EffectSID, YmInt(voice), tmpFreq)
+				} else {
+					ym.ymChip.SidSinStart(YmInt(voice), tmpFreq, YmInt(pReg[voice+8]&15))
+					ym.startEffect(EffectSinusSID, YmInt(voice), tmpFreq)
 				}
-				// TODO: Implement SidSinStart for 0x80
 			}
 
 		case 0x40: // DigiDrum
@@ -417,6 +699,7 @@ func (ym *CYmMusic) readYm6Effect(pReg []byte, code, prediv, count int) {
 						ym.pDrumTab[ndrum].Data,
 						ym.pDrumTab[ndrum].Size,
 						tmpFreq)
+					ym.startEffect(EffectDigiDrum, YmInt(voice), tmpFreq)
 				}
 			}
 
@@ -426,6 +709,7 @@ func (ym *CYmMusic) readYm6Effect(pReg []byte, code, prediv, count int) {
 			if p != 0 {
 				tmpFreq := 2457600 / p
 				ym.ymChip.SyncBuzzerStart(tmpFreq, YmInt(pReg[voice+8]&15))
+				ym.startEffect(EffectSyncBuzzer, YmInt(voice), tmpFreq)
 			}
 		}
 	}
@@ -498,7 +782,7 @@ func (ym *CYmMusic) readNextBlockInfo() {
 		ym.mixPos++
 		if ym.mixPos >= ym.nbMixBlock {
 			ym.mixPos = 0
-			if !ym.bLoop {
+			if !ym.looping() {
 				ym.bMusicOver = YmTrue
 			}
 			ym.iMusicPosAccurateSample = 0
@@ -528,12 +812,12 @@ func (ym *CYmMusic) stDigitMix(pWrite16 []YmSample, nbs int) {
 	ym.iMusicPosAccurateSample %= YmU32(ym.replayRate)
 
 	for i := 0; i < nbs; i++ {
-		sa := YmInt(YmSample(ym.pCurrentMixSample[ym.currentPos>>12]) << 8)
+		sa := YmInt(YmSample(int8(ym.pCurrentMixSample[ym.currentPos>>12])) << 8)
 
 		// Linear oversampling
 		sb := sa
 		if (ym.currentPos >> 12) < ((ym.currentSampleLength >> 12) - 1) {
-			sb = YmInt(YmSample(ym.pCurrentMixSample[(ym.currentPos>>12)+1]) << 8)
+			sb = YmInt(YmSample(int8(ym.pCurrentMixSample[(ym.currentPos>>12)+1])) << 8)
 		}
 		frac := ym.currentPos & ((1 << 12) - 1)
 		sa += ((sb - sa) * YmInt(frac)) >> 12
@@ -618,7 +902,7 @@ func (ym *CYmMusic) ymTrackerPlayer(pVoice []YmTrackerVoice) {
 			pVoice[i].SampleVolume = YmS32(line.Volume & 63)
 			pVoice[i].Loop = (line.Volume & 0x40) != 0
 
-			if line.NoteOn != 0xff {
+			if line.NoteOn != 0xff && int(line.NoteOn) < ym.nbDrum {
 				pVoice[i].Running = YmTrue
 				pVoice[i].Sample = ym.pDrumTab[line.NoteOn].Data
 				pVoice[i].SampleSize = ym.pDrumTab[line.NoteOn].Size
@@ -632,10 +916,10 @@ func (ym *CYmMusic) ymTrackerPlayer(pVoice []YmTrackerVoice) {
 
 	ym.currentFrame++
 	if ym.currentFrame >= ym.nbFrame {
-		if !ym.bLoop {
+		if !ym.looping() {
 			ym.bMusicOver = YmTrue
 		}
-		ym.currentFrame = 0
+		ym.currentFrame = ym.loopFrame
 	}
 }
 
@@ -709,6 +993,9 @@ func (ym *CYmMusic) ymTrackerUpdate(pBuffer []YmSample, nbSample int) {
 				return
 			}
 			ym.ymTrackerNbSampleBefore = ym.replayRate / int(ym.playerRate)
+			if ym.ymTrackerNbSampleBefore < 1 {
+				ym.ymTrackerNbSampleBefore = 1
+			}
 		}
 
 		nbs := ym.ymTrackerNbSampleBefore
@@ -0,0 +1,227 @@
+package stsound
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+// Run with -race: the players share no state, each one must render the same
+// samples whether it runs alone or with dozens of others
+func TestConcurrentPlayers(t *testing.T) {
+	seeds := fuzzSeeds(t)
+	const players = 48
+	table := compressedMixTable()
+
+	render := func(i int) []YmSample {
+		ym := NewYmMusic(44100)
+		// Une instance sur deux change de tables de volume et de mixage
+		if i%2 == 1 {
+			ym.SetChipModel(ChipAY8910)
+			ym.SetMixModel(MixMeasured)
+			ym.SetMixTable(table)
+		}
+		if err := ym.LoadMemory(seeds[i%len(seeds)]); err != nil {
+			t.Errorf("player %d: %v", i, err)
+			return nil
+		}
+		ym.SetLoopMode(YmTrue)
+		ym.Play()
+
+		out := make([]YmSample, 2*8192)
+		for pos := 0; pos < len(out); pos += 2 * 1024 {
+			ym.UpdateStereo(out[pos:], 1024)
+		}
+		return out
+	}
+
+	want := make([][]YmSample, players)
+	for i := range want {
+		want[i] = render(i)
+	}
+
+	got := make([][]YmSample, players)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = render(i)
+		}()
+	}
+	wg.Wait()
+
+	for i := range got {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("player %d: output differs when rendered concurrently", i)
+		}
+	}
+}
+
+// Compute, seek and position calls on the same player from several goroutines
+func TestConcurrentCalls(t *testing.T) {
+	seeds := fuzzSeeds(t)
+	const players = 24
+
+	var wg sync.WaitGroup
+	for i := 0; i < players; i++ {
+		s := CreateWithRate(44100)
+		if err := s.LoadMemory(seeds[i%len(seeds)]); err != nil {
+			t.Fatalf("player %d: %v", i, err)
+		}
+		s.SetLoopMode(true)
+		s.Play()
+
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			buffer := make([]int16, 2*512)
+			for n := 0; n < 64; n++ {
+				s.ComputeStereo(buffer, 512)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 64; n++ {
+				if s.IsSeekable() {
+					s.Seek(uint32(n*37) % uint32(s.GetInfo().MusicTimeInMs+1))
+				}
+				s.SetPanning([3]float64{0, float64(n%3) / 2, 1})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 64; n++ {
+				s.GetPos()
+				s.IsOver()
+				s.GetRegister(n % 14)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// A Sinus-SID restarted by every frame keeps its phase across frames: the
+// volume follows one sine sweep whatever the frame boundaries
+func TestSinusSidPhase(t *testing.T) {
+	// Voix A, timer à 2457600/(200*24) = 512Hz : un sinus de 62,5ms
+	song := &YmSong{Format: YM_V6, Frames: make([][16]byte, 10)}
+	for i := range song.Frames {
+		song.Frames[i] = [16]byte{0: 100, 1: 0x90, 6: 7 << 5, 7: 0x3e, 8: 15, 13: 0xff, 14: 24}
+	}
+	data, err := EncodeYM(song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ym := NewYmMusic(44100)
+	if err := ym.LoadMemory(data); err != nil {
+		t.Fatal(err)
+	}
+	ym.Play()
+
+	step := YmU32((512 << (32 - 5)) / 44100)
+	buffer := make([]YmSample, 1)
+	for n := 0; n < 5*882; n++ {
+		ym.Update(buffer, 1)
+		want := sidSinTable[15][(YmU32(n)*step)>>(32-5)]
+		if got := ym.ymChip.registers[8]; got != want {
+			t.Fatalf("sample %d (frame %d): volume %d, want %d", n, n/882, got, want)
+		}
+	}
+
+	// Une frame sans l'effet l'arrête : il repart de zéro ensuite
+	song.Frames[6][1] = 0
+	data, _ = EncodeYM(song)
+	if err := ym.LoadMemory(data); err != nil {
+		t.Fatal(err)
+	}
+	ym.Play()
+	ym.SetMusicTime(140)
+	ym.Update(buffer, 1)
+	if got := ym.ymChip.specialEffect[0].SidPos; got != step {
+		t.Errorf("SidPos %d after a restart, want %d", got, step)
+	}
+}
+
+func TestVoiceControl(t *testing.T) {
+	data := seekSong(t)
+	ref := renderTracks(t, data, func(*CYmMusic) {})
+	silent := make([]YmSample, len(ref[0]))
+	for voice, track := range ref {
+		if slices.Equal(track, silent) {
+			t.Fatalf("voice %c is silent in the test song", 'A'+voice)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		setup func(ym *CYmMusic)
+		want  [3]float64 // gain attendu sur chaque voix
+	}{
+		{"mute B", func(ym *CYmMusic) { ym.SetVoiceMute(1, YmTrue) }, [3]float64{1, 0, 1}},
+		{"solo A", func(ym *CYmMusic) { ym.SetVoiceSolo(0, YmTrue) }, [3]float64{1, 0, 0}},
+		{"solo overrides mute", func(ym *CYmMusic) {
+			ym.SetVoiceMute(0, YmTrue)
+			ym.SetVoiceMute(2, YmTrue)
+			ym.SetVoiceSolo(2, YmTrue)
+		}, [3]float64{0, 0, 1}},
+		{"unsolo", func(ym *CYmMusic) {
+			ym.SetVoiceMute(2, YmTrue)
+			ym.SetVoiceSolo(0, YmTrue)
+			ym.SetVoiceSolo(0, YmFalse)
+		}, [3]float64{1, 1, 0}},
+		{"volume", func(ym *CYmMusic) {
+			ym.SetVoiceVolume(0, 0.5)
+			ym.SetVoiceVolume(1, 2)
+			ym.SetVoiceVolume(2, 0)
+		}, [3]float64{0.5, 2, 0}},
+	} {
+		tracks := renderTracks(t, data, tc.setup)
+		for voice, gain := range tc.want {
+			level := YmInt(gain*256 + 0.5)
+			for i, s := range tracks[voice] {
+				if want := YmSample(YmInt(ref[voice][i]) * level >> 8); s != want {
+					t.Errorf("%s: voice %c sample %d = %d, want %d", tc.name, 'A'+voice, i, s, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestUpdateMultitrack(t *testing.T) {
+	data := seekSong(t)
+	render := func(multitrack bool) (mix []YmSample, tracks [3][]YmSample) {
+		ym := NewYmMusic(44100)
+		if err := ym.LoadMemory(data); err != nil {
+			t.Fatal(err)
+		}
+		ym.SetFilterChain(nil)
+		ym.Play()
+		mix = make([]YmSample, 4*44100)
+		if !multitrack {
+			ym.Update(mix, len(mix))
+			return mix, tracks
+		}
+		for i := range tracks {
+			tracks[i] = make([]YmSample, len(mix))
+		}
+		// Des buffers de tailles variées, à cheval sur les frames
+		for pos, n := 0, 1; pos < len(mix); pos, n = pos+n, n*3%1999+1 {
+			n = min(n, len(mix)-pos)
+			ym.UpdateMultitrack([3][]YmSample{tracks[0][pos:], tracks[1][pos:], tracks[2][pos:]}, mix[pos:], n)
+		}
+		return mix, tracks
+	}
+
+	mono, _ := render(false)
+	mix, tracks := render(true)
+	if !slices.Equal(mix, mono) {
+		t.Error("the multitrack mix differs from the mono rendering")
+	}
+	for i := range mix {
+		if sum := tracks[0][i] + tracks[1][i] + tracks[2][i]; sum != mix[i] {
+			t.Fatalf("sample %d: tracks add up to %d, mix is %d", i, sum, mix[i])
+		}
+	}
+}